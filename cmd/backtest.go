@@ -3,9 +3,13 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ztrade/base/common"
+	"github.com/ztrade/ztrade/pkg/core"
 	"github.com/ztrade/ztrade/pkg/ctl"
+	"github.com/ztrade/ztrade/pkg/process/vex"
 
 	log "github.com/sirupsen/logrus"
 
@@ -30,6 +34,29 @@ var (
 	simpleReport bool
 
 	rptDB string
+
+	maxLose      float64
+	maxPos       float64
+	maxDailyLose float64
+	maxOrders    int
+
+	slippage      string
+	slippageValue float64
+	tickSize      float64
+	mmr           float64
+	funding       time.Duration
+	pricePath     string
+	tickMode      bool
+	bookMode      bool
+	participation float64
+	latency       string
+	latencyValue  time.Duration
+	latencyJitter time.Duration
+	spot          bool
+	hedge         bool
+	makerFee      float64
+	takerFee      float64
+	feeTiers      string
 )
 
 // backtestCmd represents the backtest command
@@ -43,7 +70,7 @@ var backtestCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(backtestCmd)
 
-	backtestCmd.PersistentFlags().StringVar(&scriptFile, "script", "", "script file to backtest")
+	backtestCmd.PersistentFlags().StringVar(&scriptFile, "script", "", "script file to backtest, many scripts are separated by comma")
 	backtestCmd.PersistentFlags().StringVarP(&rptFile, "report", "o", "report.html", "output report html file path")
 	backtestCmd.PersistentFlags().Float64VarP(&balanceInit, "balance", "", 100000, "init total balance")
 	backtestCmd.PersistentFlags().StringVar(&param, "param", "", "param json string")
@@ -52,6 +79,27 @@ func init() {
 	backtestCmd.PersistentFlags().Float64VarP(&lever, "lever", "", 1, "lever")
 	backtestCmd.PersistentFlags().BoolVarP(&simpleReport, "console", "", false, "print report to console")
 	backtestCmd.PersistentFlags().StringVarP(&rptDB, "reportDB", "d", "", "save all actions to sqlite db")
+	backtestCmd.PersistentFlags().Float64VarP(&maxLose, "maxLose", "", 0, "risk: max lose ratio of balance, trigger kill switch when reached")
+	backtestCmd.PersistentFlags().Float64VarP(&maxPos, "maxPos", "", 0, "risk: max position size")
+	backtestCmd.PersistentFlags().Float64VarP(&maxDailyLose, "maxDailyLose", "", 0, "risk: max lose ratio in one day")
+	backtestCmd.PersistentFlags().IntVarP(&maxOrders, "maxOrders", "", 0, "risk: max orders per minute")
+	backtestCmd.PersistentFlags().StringVarP(&slippage, "slippage", "", "none", "slippage of market and stop orders: none,tick,percent,volume")
+	backtestCmd.PersistentFlags().Float64VarP(&slippageValue, "slippageValue", "", 0, "slippage value: ticks for tick, percent for percent(0.1 means 0.1%), factor for volume, price moves price*factor*amount/volume")
+	backtestCmd.PersistentFlags().Float64VarP(&tickSize, "tickSize", "", 0, "tick size of symbol, used by tick slippage")
+	backtestCmd.PersistentFlags().Float64VarP(&mmr, "mmr", "", 0.005, "maintenance margin rate, position is liquidated when margin ratio reach it")
+	backtestCmd.PersistentFlags().DurationVarP(&funding, "funding", "", 0, "funding interval of perpetual swap, such as 8h, use funding rates downloaded by download --funding, 0 means disabled")
+	backtestCmd.PersistentFlags().StringVarP(&pricePath, "path", "", "ohlc", "price path inside candle which decides fill order: ohlc,olhc,nearest,pessimistic")
+	backtestCmd.PersistentFlags().BoolVarP(&tickMode, "tick", "", false, "backtest with market trades recorded by trade --record")
+	backtestCmd.PersistentFlags().BoolVarP(&bookMode, "book", "", false, "backtest with depths and market trades recorded by trade --record, limit orders are matched with order book")
+	backtestCmd.PersistentFlags().Float64VarP(&participation, "participation", "", 0, "max fill amount of order per candle as a fraction of candle volume, such as 0.1, 0 means orders are filled in full")
+	backtestCmd.PersistentFlags().StringVarP(&latency, "latency", "", "none", "latency of orders and cancels: none,fixed,uniform,normal")
+	backtestCmd.PersistentFlags().DurationVarP(&latencyValue, "latencyValue", "", 0, "delay of fixed latency, center of uniform latency or mean of normal latency, such as 200ms")
+	backtestCmd.PersistentFlags().DurationVarP(&latencyJitter, "latencyJitter", "", 0, "half range of uniform latency or standard deviation of normal latency")
+	backtestCmd.PersistentFlags().BoolVarP(&spot, "spot", "", false, "backtest with spot account: base and quote balances, no lever and no short")
+	backtestCmd.PersistentFlags().BoolVarP(&hedge, "hedge", "", false, "backtest with hedge mode account: long and short positions are held independently, lever must be 1")
+	backtestCmd.PersistentFlags().Float64VarP(&makerFee, "makerFee", "", 0, "fee rate of orders rest in book, negative means rebate, fee is used if not set")
+	backtestCmd.PersistentFlags().Float64VarP(&takerFee, "takerFee", "", 0, "fee rate of orders take liquidity, fee is used if not set")
+	backtestCmd.PersistentFlags().StringVarP(&feeTiers, "feeTiers", "", "", "fee tiers by traded volume in quote: volume:maker:taker,volume:maker:taker")
 	initTimeRange(backtestCmd)
 }
 
@@ -65,6 +113,21 @@ func runBacktest(cmd *cobra.Command, args []string) {
 		log.Fatal(err.Error())
 		return
 	}
+	slip, err := vex.NewSlippage(slippage, slippageValue, tickSize)
+	if err != nil {
+		log.Fatal(err.Error())
+		return
+	}
+	path, err := vex.NewPricePath(pricePath)
+	if err != nil {
+		log.Fatal(err.Error())
+		return
+	}
+	lat, err := vex.NewLatency(latency, latencyValue, latencyJitter)
+	if err != nil {
+		log.Fatal(err.Error())
+		return
+	}
 	cfg := viper.GetViper()
 	db, err := initDB(cfg)
 	if err != nil {
@@ -72,15 +135,54 @@ func runBacktest(cmd *cobra.Command, args []string) {
 	}
 
 	r := report.NewReportSimple()
-	back, err := ctl.NewBacktest(db, exchangeName, symbol, param, startTime, endTime)
+	// many symbols separated by comma are backtested in one portfolio
+	symbols := strings.Split(symbol, ",")
+	back, err := ctl.NewBacktest(db, exchangeName, symbols[0], param, startTime, endTime)
 	if err != nil {
 		log.Fatal("init backtest failed:", err.Error())
 	}
-	back.SetScript(scriptFile)
+	if len(symbols) > 1 {
+		back.SetSymbols(symbols)
+	}
+	scripts := strings.Split(scriptFile, ",")
+	back.SetScript(scripts[0])
+	for _, v := range scripts[1:] {
+		back.AddScript(v)
+	}
 	back.SetReporter(r)
 	back.SetBalanceInit(balanceInit, fee)
 	back.SetLoadDBOnce(loadOnce)
 	back.SetLever(lever)
+	back.SetSlippage(slip)
+	back.SetPricePath(path)
+	back.SetTickMode(tickMode)
+	back.SetBookMode(bookMode)
+	back.SetParticipation(participation)
+	back.SetLatency(lat)
+	if spot && hedge {
+		log.Fatal("spot and hedge can't be used together")
+	}
+	back.SetSpot(spot)
+	back.SetHedge(hedge)
+	if cmd.Flags().Changed("makerFee") || cmd.Flags().Changed("takerFee") || feeTiers != "" {
+		if !cmd.Flags().Changed("makerFee") {
+			makerFee = fee
+		}
+		if !cmd.Flags().Changed("takerFee") {
+			takerFee = fee
+		}
+		fees, err := core.NewFeeSchedule(makerFee, takerFee, feeTiers)
+		if err != nil {
+			log.Fatal(err.Error())
+			return
+		}
+		back.SetFees(fees)
+	}
+	back.SetMaintenanceMargin(mmr)
+	back.SetFunding(funding)
+	if maxLose != 0 || maxPos != 0 || maxDailyLose != 0 || maxOrders != 0 {
+		back.SetRiskLimit(core.RiskLimit{MaxLostRatio: maxLose, MaxPosition: maxPos, MaxDailyLostRatio: maxDailyLose, MaxOrdersPerMinute: maxOrders})
+	}
 
 	err = back.Run()
 
@@ -20,13 +20,15 @@ var downloadCmd = &cobra.Command{
 }
 
 var (
-	bAuto *bool
+	bAuto    *bool
+	bFunding *bool
 )
 
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 	initTimeRange(downloadCmd)
 	bAuto = downloadCmd.PersistentFlags().BoolP("auto", "a", false, "auto download")
+	bFunding = downloadCmd.PersistentFlags().BoolP("funding", "", false, "download funding rates of perpetual swap, only binance futures is supported")
 }
 
 func runDownload(cmd *cobra.Command, args []string) {
@@ -46,6 +48,7 @@ func runDownload(cmd *cobra.Command, args []string) {
 	} else {
 		down = ctl.NewDataDownload(cfg, db, exchangeName, symbol, binSize, startTime, endTime)
 	}
+	down.SetFunding(*bFunding)
 	err = down.Run()
 	if err != nil {
 		fmt.Println("download data error", err.Error())
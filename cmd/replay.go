@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ztrade/base/common"
+	"github.com/ztrade/ztrade/pkg/ctl"
+	"github.com/ztrade/ztrade/pkg/report"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+)
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "replay journal with script",
+	Long:  `replay a journal recorded by trade command with script`,
+	Run:   runReplay,
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.PersistentFlags().StringVar(&scriptFile, "script", "", "script file to replay")
+	replayCmd.PersistentFlags().StringVarP(&journalFile, "journal", "j", "", "journal file recorded by trade command")
+	replayCmd.PersistentFlags().StringVarP(&rptFile, "report", "o", "report.html", "output report html file path")
+	replayCmd.PersistentFlags().StringVar(&symbol, "symbol", "BTCUSDT", "symbol")
+	replayCmd.PersistentFlags().StringVar(&param, "param", "", "param json string")
+}
+
+func runReplay(cmd *cobra.Command, args []string) {
+	if scriptFile == "" {
+		log.Fatal("strategy file can't be empty")
+		return
+	}
+	if journalFile == "" {
+		log.Fatal("journal file can't be empty")
+		return
+	}
+	r := report.NewReportSimple()
+	rp, err := ctl.NewReplay(journalFile, symbol, param)
+	if err != nil {
+		log.Fatal("init replay failed:", err.Error())
+	}
+	rp.SetScript(scriptFile)
+	rp.SetReporter(r)
+	err = rp.Run()
+	if err != nil {
+		fmt.Println("run replay error", err.Error())
+		log.Fatal("run replay error", err.Error())
+	}
+	err = r.GenRPT(rptFile)
+	if err != nil {
+		return
+	}
+	err = common.OpenURL(rptFile)
+	if err != nil {
+		log.Fatal("open url failed:", err.Error())
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/ztrade/base/common"
+	"github.com/ztrade/ztrade/pkg/report"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "report of live trades",
+	Long:  `generate report of live trades saved by trade --saveTrades`,
+	Run:   runReport,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.PersistentFlags().StringVarP(&rptFile, "report", "o", "report.html", "output report html file path")
+	reportCmd.PersistentFlags().Float64VarP(&balanceInit, "balance", "", 100000, "init total balance")
+	reportCmd.PersistentFlags().Float64VarP(&fee, "fee", "", 0.0001, "fee")
+	reportCmd.PersistentFlags().Float64VarP(&lever, "lever", "", 1, "lever")
+	initTimeRange(reportCmd)
+}
+
+func runReport(cmd *cobra.Command, args []string) {
+	startTime, endTime, err := parseTimeRange()
+	if err != nil {
+		log.Fatal(err.Error())
+		return
+	}
+	db, err := initDB(viper.GetViper())
+	if err != nil {
+		log.Fatal("init db failed:", err.Error())
+	}
+	trades, err := db.GetTradeTbl(exchangeName, symbol).GetTrades(startTime, endTime)
+	if err != nil {
+		log.Fatal("load trades failed:", err.Error())
+	}
+	log.Infof("load %d trades of %s %s", len(trades), exchangeName, symbol)
+	r := report.NewReport(trades, balanceInit)
+	r.SetFee(fee)
+	r.SetLever(lever)
+	err = r.GenRPT(rptFile)
+	if err != nil {
+		log.Fatal("generate report failed:", err.Error())
+	}
+	err = common.OpenURL(rptFile)
+	if err != nil {
+		log.Fatal("open url failed:", err.Error())
+	}
+}
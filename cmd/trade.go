@@ -15,6 +15,7 @@ import (
 	"github.com/ztrade/ztrade/pkg/report"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // tradeCmd represents the trade command
@@ -26,7 +27,11 @@ var tradeCmd = &cobra.Command{
 }
 
 var (
-	recentDay int
+	recentDay   int
+	journalFile string
+	bRecord     bool
+	bSaveTrades bool
+	bPaper      bool
 )
 
 func init() {
@@ -38,6 +43,12 @@ func init() {
 	tradeCmd.PersistentFlags().StringVar(&exchangeName, "exchange", "bitmex", "exchange name, only support bitmex current now")
 	tradeCmd.PersistentFlags().IntVarP(&recentDay, "recent", "r", 1, "load recent (n) day data,default 1")
 	tradeCmd.PersistentFlags().StringVar(&param, "param", "", "param json string")
+	tradeCmd.PersistentFlags().BoolVarP(&bRecord, "record", "", false, "record market trades and depths to db, can be used by backtest --tick or --book")
+	tradeCmd.PersistentFlags().BoolVarP(&bSaveTrades, "saveTrades", "", false, "save orders, order status and trades to db, can be analyzed by report command")
+	tradeCmd.PersistentFlags().BoolVarP(&bPaper, "paper", "", false, "paper trade: market data of exchange, orders are filled by virtual exchange with market trades")
+	tradeCmd.PersistentFlags().Float64VarP(&balanceInit, "balance", "", 100000, "init total balance of paper trade")
+	tradeCmd.PersistentFlags().Float64VarP(&fee, "fee", "", 0.0001, "fee of paper trade")
+	tradeCmd.PersistentFlags().StringVarP(&journalFile, "journal", "j", "", "record all events to journal file, can be replayed by replay command")
 }
 
 func runTrade(cmd *cobra.Command, args []string) {
@@ -52,6 +63,27 @@ func runTrade(cmd *cobra.Command, args []string) {
 	if recentDay != 0 {
 		real.SetLoadRecent(time.Duration(recentDay) * time.Hour * 24)
 	}
+	if journalFile != "" {
+		real.SetJournal(journalFile)
+	}
+	if bRecord {
+		db, err := initDB(viper.GetViper())
+		if err != nil {
+			log.Fatal("init db failed:", err.Error())
+		}
+		real.SetRecordDB(db)
+	}
+	if bPaper {
+		real.SetPaper(true)
+		real.SetBalanceInit(balanceInit, fee)
+	}
+	if bSaveTrades {
+		db, err := initDB(viper.GetViper())
+		if err != nil {
+			log.Fatal("init db failed:", err.Error())
+		}
+		real.SetTradeDB(db)
+	}
 	r := report.NewReportSimple()
 	real.SetReporter(r)
 	paramData := make(map[string]interface{})
@@ -5,6 +5,7 @@ go 1.22.1
 toolchain go1.22.6
 
 require (
+	github.com/adshao/go-binance/v2 v2.6.1
 	github.com/go-sql-driver/mysql v1.8.1
 	github.com/goplus/igop v0.26.0
 	github.com/json-iterator/go v1.1.12
@@ -34,7 +35,6 @@ require (
 	github.com/CloudyKit/jet/v6 v6.2.0 // indirect
 	github.com/Joker/jade v1.1.3 // indirect
 	github.com/Shopify/goreferrer v0.0.0-20240724165105-aceaa0259138 // indirect
-	github.com/adshao/go-binance/v2 v2.6.1 // indirect
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/aymerick/douceur v0.2.0 // indirect
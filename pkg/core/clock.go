@@ -0,0 +1,59 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock provide current time for bus, engine and exchanges
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockEngine engine which provides current time, scripts can use it by type assertion
+type ClockEngine interface {
+	Now() time.Time
+}
+
+// ClockUpdater clock driven by the time of datas
+type ClockUpdater interface {
+	Update(t time.Time)
+}
+
+// WallClock clock of real world, used in real trade
+type WallClock struct{}
+
+func NewWallClock() *WallClock {
+	return new(WallClock)
+}
+
+func (c *WallClock) Now() time.Time {
+	return time.Now()
+}
+
+// VirtualClock clock driven by candles, used in backtest
+type VirtualClock struct {
+	now int64
+}
+
+func NewVirtualClock() *VirtualClock {
+	return new(VirtualClock)
+}
+
+func (c *VirtualClock) Now() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.now))
+}
+
+// Update update the time of clock, clock never goes back
+func (c *VirtualClock) Update(t time.Time) {
+	n := t.UnixNano()
+	for {
+		old := atomic.LoadInt64(&c.now)
+		if n <= old {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&c.now, old, n) {
+			return
+		}
+	}
+}
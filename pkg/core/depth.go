@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+)
+
+// DepthSnapshot order book snapshot stored in db
+type DepthSnapshot struct {
+	ID        int64       `xorm:"pk autoincr null 'id'"`
+	Start     int64       `xorm:"index 'start'"`              // unix second
+	Timestamp int64       `xorm:"unique notnull 'timestamp'"` // unix millisecond
+	Sells     []DepthInfo `xorm:"json 'sells'"`
+	Buys      []DepthInfo `xorm:"json 'buys'"`
+	Table     string      `xorm:"-"`
+}
+
+// NewDepthSnapshot create snapshot from depth
+func NewDepthSnapshot(depth *Depth) *DepthSnapshot {
+	return &DepthSnapshot{
+		Start:     depth.UpdateTime.Unix(),
+		Timestamp: depth.UpdateTime.UnixMilli(),
+		Sells:     depth.Sells,
+		Buys:      depth.Buys,
+	}
+}
+
+func (d DepthSnapshot) TableName() string {
+	return d.Table
+}
+
+func (d DepthSnapshot) GetTable() string {
+	return d.Table
+}
+
+func (d DepthSnapshot) GetStart() int64 {
+	return d.Start
+}
+
+func (d *DepthSnapshot) SetTable(tbl string) {
+	d.Table = tbl
+}
+
+func (d DepthSnapshot) Time() time.Time {
+	return time.UnixMilli(d.Timestamp)
+}
+
+// Depth convert to depth
+func (d DepthSnapshot) Depth() *Depth {
+	return &Depth{Sells: d.Sells, Buys: d.Buys, UpdateTime: d.Time()}
+}
+
+func (d DepthSnapshot) String() string {
+	return fmt.Sprintf("%s sells:%d buys:%d", d.Time().String(), len(d.Sells), len(d.Buys))
+}
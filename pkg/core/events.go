@@ -18,8 +18,22 @@ const (
 	EventTrade       = "trade"
 	EventPosition    = "position"
 	EventCurPosition = "cur_position" // position of current script
-	EventRiskLimit   = "risk_limit"
-	EventDepth       = "depth"
+	// long and short positions in hedge mode
+	EventHedgePosition = "hedge_position"
+	EventRiskLimit     = "risk_limit"
+	// order rejected by risk manager
+	EventOrderReject = "order_reject"
+	// result of amending order
+	EventOrderAmend = "order_amend"
+	// status update of order
+	EventOrderStatus = "order_status"
+	// all orders canceled and scripts halted
+	EventKillSwitch = "kill_switch"
+	// position force closed by exchange
+	EventLiquidation = "liquidation"
+	// funding payment of perpetual swap
+	EventFunding = "funding"
+	EventDepth   = "depth"
 	// all trades in the markets
 	EventTradeMarket = "trade_market"
 
@@ -43,13 +57,21 @@ var (
 		EventPosition: reflect.TypeOf(Position{}),
 		// EventCurPosition        = "cur_position" // position of current script
 		// EventRiskLimit          = "risk_limit"
-		EventDepth:       reflect.TypeOf(Depth{}),
-		EventTradeMarket: reflect.TypeOf(Trade{}),
-		EventBalance:     reflect.TypeOf(Balance{}),
-		EventBalanceInit: reflect.TypeOf(BalanceInfo{}),
-		EventWatch:       reflect.TypeOf(WatchParam{}),
-		EventNotify:      reflect.TypeOf(NotifyEvent{}),
-		EventWatchCandle: reflect.TypeOf(CandleParam{}),
+		EventDepth:         reflect.TypeOf(Depth{}),
+		EventTradeMarket:   reflect.TypeOf(Trade{}),
+		EventBalance:       reflect.TypeOf(Balance{}),
+		EventBalanceInit:   reflect.TypeOf(BalanceInfo{}),
+		EventWatch:         reflect.TypeOf(WatchParam{}),
+		EventNotify:        reflect.TypeOf(NotifyEvent{}),
+		EventWatchCandle:   reflect.TypeOf(CandleParam{}),
+		EventRiskLimit:     reflect.TypeOf(RiskLimit{}),
+		EventOrderReject:   reflect.TypeOf(OrderReject{}),
+		EventOrderAmend:    reflect.TypeOf(OrderAmend{}),
+		EventOrderStatus:   reflect.TypeOf(OrderUpdate{}),
+		EventKillSwitch:    reflect.TypeOf(KillSwitch{}),
+		EventLiquidation:   reflect.TypeOf(Liquidation{}),
+		EventFunding:       reflect.TypeOf(Funding{}),
+		EventHedgePosition: reflect.TypeOf(HedgePosition{}),
 	}
 
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -73,9 +95,40 @@ type NotifyEvent struct {
 
 // RiskLimit risk limit
 type RiskLimit struct {
-	Code         string  // symbol info, empty = global
-	Lever        float64 // lever
-	MaxLostRatio float64 // max lose ratio
+	Code               string  // symbol info, empty = global
+	Lever              float64 // lever
+	MaxLostRatio       float64 // max lose ratio
+	MaxPosition        float64 // max position size, 0 = no limit
+	MaxDailyLostRatio  float64 // max lose ratio in one day, 0 = no limit
+	MaxOrdersPerMinute int     // max orders per minute, 0 = no limit
+}
+
+// OrderReject order rejected by risk manager
+type OrderReject struct {
+	Action TradeAction
+	Reason string
+}
+
+// OrderAmend result of amending order, Reason is empty if the order is amended
+type OrderAmend struct {
+	Action TradeAction
+	Reason string
+}
+
+// KillSwitch all orders are canceled and scripts are halted
+type KillSwitch struct {
+	Reason string
+}
+
+// RemarkLiquidation remark of trades closed by liquidation
+const RemarkLiquidation = "liquidation"
+
+// Liquidation position force closed by exchange
+type Liquidation struct {
+	Symbol string
+	Hold   float64 // position before liquidation
+	Price  float64 // liquidation price
+	Time   time.Time
 }
 
 // Key key of r
@@ -100,6 +153,13 @@ func (d *EventData) UnmarshalJSON(buf []byte) (err error) {
 		d.Data = map[string]interface{}{}
 	}
 	err = json.Unmarshal([]byte(ret.Get("data").Raw), d.Data)
+	if err != nil {
+		return
+	}
+	extra := ret.Get("extra")
+	if extra.Exists() {
+		d.Extra = extra.Value()
+	}
 	return
 }
 
@@ -119,4 +179,6 @@ func NewWatchCandle(cp *CandleParam) *WatchParam {
 type BalanceInfo struct {
 	Balance float64
 	Fee     float64
+	// Fees maker and taker fee rates, Fee is used for all trades if nil
+	Fees *FeeSchedule
 }
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RemarkMaker remark of trades filled by resting orders
+	RemarkMaker = "maker"
+	// RemarkTaker remark of trades filled by orders which take liquidity
+	RemarkTaker = "taker"
+)
+
+// FeeTier fee rates used after the traded volume in quote reaches Volume
+type FeeTier struct {
+	Volume float64
+	Maker  float64
+	Taker  float64
+}
+
+// FeeSchedule maker and taker fee rates, negative maker rate is rebate,
+// tiers are sorted by volume and the last tier reached is used
+type FeeSchedule struct {
+	Maker float64
+	Taker float64
+	Tiers []FeeTier
+}
+
+// NewFeeSchedule create fee schedule with tiers in format "volume:maker:taker,volume:maker:taker"
+func NewFeeSchedule(maker, taker float64, tiers string) (s *FeeSchedule, err error) {
+	s = &FeeSchedule{Maker: maker, Taker: taker}
+	if tiers == "" {
+		return
+	}
+	for _, v := range strings.Split(tiers, ",") {
+		parts := strings.Split(v, ":")
+		if len(parts) != 3 {
+			err = fmt.Errorf("invalid fee tier: %s", v)
+			return
+		}
+		var values [3]float64
+		for i, p := range parts {
+			values[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				err = fmt.Errorf("invalid fee tier %s: %w", v, err)
+				return
+			}
+		}
+		s.Tiers = append(s.Tiers, FeeTier{Volume: values[0], Maker: values[1], Taker: values[2]})
+	}
+	sort.Slice(s.Tiers, func(i, j int) bool {
+		return s.Tiers[i].Volume < s.Tiers[j].Volume
+	})
+	return
+}
+
+// Rate return the fee rate of fill, volume is the traded volume in quote before the fill
+func (s *FeeSchedule) Rate(maker bool, volume float64) float64 {
+	m, t := s.Maker, s.Taker
+	for _, v := range s.Tiers {
+		if volume < v.Volume {
+			break
+		}
+		m, t = v.Maker, v.Taker
+	}
+	if maker {
+		return m
+	}
+	return t
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// FundingRate funding rate of perpetual swap
+type FundingRate struct {
+	ID        int64   `xorm:"pk autoincr null 'id'"`
+	Start     int64   `xorm:"unique index 'start'"` // funding time
+	Rate      float64 `xorm:"notnull 'rate'"`
+	MarkPrice float64 `xorm:"'mark_price'"`
+	Table     string  `xorm:"-"`
+}
+
+func (f FundingRate) TableName() string {
+	return f.Table
+}
+
+func (f FundingRate) GetTable() string {
+	return f.Table
+}
+
+func (f FundingRate) GetStart() int64 {
+	return f.Start
+}
+
+func (f *FundingRate) SetTable(tbl string) {
+	f.Table = tbl
+}
+
+func (f FundingRate) Time() time.Time {
+	return time.Unix(f.Start, 0)
+}
+
+func (f FundingRate) String() string {
+	return fmt.Sprintf("%s rate:%f mark price:%f", f.Time().String(), f.Rate, f.MarkPrice)
+}
+
+// RemarkFunding remark of funding payment rows in report
+const RemarkFunding = "funding"
+
+// FundingRateFetcher exchange which support fetch history funding rates
+type FundingRateFetcher interface {
+	GetFundingRates(symbol string, start, end time.Time) (rates []*FundingRate, err error)
+}
+
+// Funding funding payment of position, Amount < 0 means paid
+type Funding struct {
+	Symbol string
+	Time   time.Time
+	Rate   float64
+	Price  float64
+	Hold   float64
+	Amount float64
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"math"
+
+	"github.com/ztrade/base/common"
+	. "github.com/ztrade/trademodel"
+)
+
+// PositionLeg one side of position in hedge mode, Hold is positive
+type PositionLeg struct {
+	Hold  float64
+	Price float64
+	// Profit realized profit of leg with fees
+	Profit float64
+}
+
+// HedgePosition long and short positions of symbol held independently in hedge mode, sent by EventHedgePosition
+type HedgePosition struct {
+	Symbol string
+	Long   PositionLeg
+	Short  PositionLeg
+}
+
+// Net return the net position, long minus short
+func (p HedgePosition) Net() float64 {
+	return common.FloatSub(p.Long.Hold, p.Short.Hold)
+}
+
+// IsLongLeg return true if the order works on the long leg in hedge mode
+func IsLongLeg(typ TradeType) bool {
+	return typ&DirectLong == DirectLong
+}
+
+// HedgePositionEngine engine which tracks long and short legs in hedge mode, scripts can use it by type assertion
+type HedgePositionEngine interface {
+	HedgePosition() HedgePosition
+}
+
+// HedgePositionHandler script which handles the updates of long and short legs in hedge mode
+type HedgePositionHandler interface {
+	OnHedgePosition(pos *HedgePosition)
+}
+
+// HedgeExchange exchange which supports hedge mode, orders are sent with the position side of their leg,
+// positions sent by exchange must have the Type of their leg, zero opt means GTC
+type HedgeExchange interface {
+	ProcessHedgeOrder(act TradeAction, opt OrderOption) (ret *Order, err error)
+}
+
+// HedgeBalance balance of hedge mode account, open and close orders work on the leg of their direction,
+// close order closes the hold of its leg at most
+type HedgeBalance struct {
+	total float64
+	fee   float64
+	lever float64
+	long  PositionLeg
+	short PositionLeg
+}
+
+func NewHedgeBalance() *HedgeBalance {
+	return &HedgeBalance{lever: 1}
+}
+
+func (b *HedgeBalance) Set(total float64) {
+	b.total = total
+}
+
+func (b *HedgeBalance) SetFee(fee float64) {
+	b.fee = fee
+}
+
+func (b *HedgeBalance) SetLever(lever float64) {
+	if lever > 0 {
+		b.lever = lever
+	}
+}
+
+// Get return the balance with realized profits
+func (b *HedgeBalance) Get() float64 {
+	return b.total
+}
+
+// AddFunding add funding payment to balance
+func (b *HedgeBalance) AddFunding(amount float64) {
+	b.total += amount
+}
+
+// Pos return the net position
+func (b *HedgeBalance) Pos() float64 {
+	return b.Position().Net()
+}
+
+// Position return the long and short legs
+func (b *HedgeBalance) Position() HedgePosition {
+	return HedgePosition{Long: b.long, Short: b.short}
+}
+
+// Margin return the margin used by both legs
+func (b *HedgeBalance) Margin() float64 {
+	return (b.long.Hold*b.long.Price + b.short.Hold*b.short.Price) / b.lever
+}
+
+// AddTrade open or close the leg of trade, profit is the realized profit of close with fee
+func (b *HedgeBalance) AddTrade(tr Trade) (profit, onceFee float64, err error) {
+	leg := &b.short
+	if IsLongLeg(tr.Action) {
+		leg = &b.long
+	}
+	amount := math.Abs(tr.Amount)
+	if !tr.Action.IsOpen() {
+		amount = math.Min(amount, leg.Hold)
+	}
+	if amount == 0 {
+		return
+	}
+	value := common.FloatMul(amount, tr.Price)
+	onceFee = common.FloatMul(value, b.fee)
+	if tr.Action.IsOpen() {
+		if b.total-b.Margin() < value/b.lever+onceFee {
+			err = common.ErrNoBalance
+			return
+		}
+		leg.Price = (leg.Hold*leg.Price + value) / (leg.Hold + amount)
+		leg.Hold = common.FloatAdd(leg.Hold, amount)
+		profit = -onceFee
+	} else {
+		diff := tr.Price - leg.Price
+		if leg == &b.short {
+			diff = -diff
+		}
+		profit = diff*amount - onceFee
+		leg.Hold = common.FloatSub(leg.Hold, amount)
+		if leg.Hold == 0 {
+			leg.Price = 0
+		}
+	}
+	leg.Profit = common.FloatAdd(leg.Profit, profit)
+	b.total = common.FloatAdd(b.total, profit)
+	return
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+)
+
+// AmendOne amend the price or amount of working order with the same id, zero price or amount means unchanged,
+// amount is the total amount of order including the filled part
+const AmendOne TradeType = -3
+
+// OrderState state of order in its lifecycle
+type OrderState string
+
+const (
+	// OrderNew order is accepted and working
+	OrderNew OrderState = "NEW"
+	// OrderPartiallyFilled part of order is filled, the rest is working
+	OrderPartiallyFilled OrderState = "PARTIALLY_FILLED"
+	// OrderFilled order is filled in full
+	OrderFilled OrderState = "FILLED"
+	// OrderCanceled order is canceled by strategy, exchange or linked order
+	OrderCanceled OrderState = "CANCELED"
+	// OrderRejected order is rejected by risk manager or exchange
+	OrderRejected OrderState = "REJECTED"
+	// OrderExpired GTD order is expired
+	OrderExpired OrderState = "EXPIRED"
+)
+
+// IsFinal return true if the order won't change any more
+func (s OrderState) IsFinal() bool {
+	return s != OrderNew && s != OrderPartiallyFilled
+}
+
+// OrderUpdate status update of order, sent by EventOrderStatus
+type OrderUpdate struct {
+	Action TradeAction
+	Status OrderState
+	// Filled total filled amount of order
+	Filled float64
+	// Reason reason of rejection or cancellation
+	Reason string
+	Time   time.Time
+}
+
+// OrderHandler script which handles the status updates of its orders
+type OrderHandler interface {
+	OnOrder(update *OrderUpdate)
+}
+
+// TimeInForce how long an order keeps working
+type TimeInForce string
+
+const (
+	// GTC good till canceled
+	GTC TimeInForce = "GTC"
+	// IOC immediate or cancel, the part not filled immediately is canceled
+	IOC TimeInForce = "IOC"
+	// FOK fill or kill, the order is canceled if it can't be filled in full immediately
+	FOK TimeInForce = "FOK"
+	// GTD good till date, the order is canceled at ExpireTime
+	GTD TimeInForce = "GTD"
+	// PostOnly maker only order, the order is rejected if it would take liquidity
+	PostOnly TimeInForce = "PostOnly"
+)
+
+// OrderOption options of order, sent as the extra of EventOrder
+type OrderOption struct {
+	TimeInForce TimeInForce
+	// ExpireTime expire time of GTD order
+	ExpireTime time.Time
+	// GroupID id of linked order group, filling an order of group reduces the others
+	GroupID string
+	// ParentID id of the entry order of bracket, the order works after the parent is filled
+	ParentID string
+	// TrailDistance stop price of trailing stop keeps the distance from the best price
+	TrailDistance float64
+	// TrailPercent stop price of trailing stop keeps the percent from the best price, 1 means 1%
+	TrailPercent float64
+}
+
+// Validate check if the option is valid, empty TimeInForce means GTC
+func (o OrderOption) Validate() (err error) {
+	switch o.TimeInForce {
+	case "", GTC, IOC, FOK, PostOnly:
+	case GTD:
+		if o.ExpireTime.IsZero() {
+			err = fmt.Errorf("GTD order without expire time")
+		}
+	default:
+		err = fmt.Errorf("unsupport time in force: %s", o.TimeInForce)
+	}
+	if err == nil && o.ParentID != "" && o.GroupID == "" {
+		err = fmt.Errorf("order with parent %s but without group", o.ParentID)
+	}
+	if err == nil && (o.TrailDistance < 0 || o.TrailPercent < 0 || (o.TrailDistance > 0 && o.TrailPercent > 0)) {
+		err = fmt.Errorf("invalid trailing stop, distance: %f, percent: %f", o.TrailDistance, o.TrailPercent)
+	}
+	return
+}
+
+// IsTrailing return true if the order is a trailing stop
+func (o OrderOption) IsTrailing() bool {
+	return o.TrailDistance > 0 || o.TrailPercent > 0
+}
+
+// TrailStop update the best price and stop price of trailing stop with new price,
+// stop of long position is below the best price, the stop price never moves back,
+// zero best or stop means not set yet
+func (o OrderOption) TrailStop(long bool, best, stop, price float64) (newBest, newStop float64) {
+	newBest, newStop = best, stop
+	if best == 0 || (long && price > best) || (!long && price < best) {
+		newBest = price
+	}
+	offset := o.TrailDistance
+	if o.TrailPercent > 0 {
+		offset = newBest * o.TrailPercent / 100
+	}
+	trail := newBest + offset
+	if long {
+		trail = newBest - offset
+	}
+	if stop == 0 || (long && trail > stop) || (!long && trail < stop) {
+		newStop = trail
+	}
+	return
+}
+
+// IsImmediate return true if the order only works immediately
+func (o OrderOption) IsImmediate() bool {
+	return o.TimeInForce == IOC || o.TimeInForce == FOK
+}
+
+// IsGrouped return true if the order is a leg of linked order group
+func (o OrderOption) IsGrouped() bool {
+	return o.GroupID != ""
+}
+
+// IsGTC return true if the order works until canceled
+func (o OrderOption) IsGTC() bool {
+	return o.TimeInForce == "" || o.TimeInForce == GTC
+}
+
+// OrderOptionExchange exchange which supports order options
+type OrderOptionExchange interface {
+	ProcessOrderWithOption(act TradeAction, opt OrderOption) (ret *Order, err error)
+}
+
+// TrailingStopExchange exchange which supports part of trailing stops, the others are emulated locally
+type TrailingStopExchange interface {
+	IsNativeTrailing(opt OrderOption) bool
+}
+
+// OrderAmendExchange exchange which supports amending order natively
+type OrderAmendExchange interface {
+	AmendOrder(old *Order, price, amount float64) (ret *Order, err error)
+}
+
+// OrderAmendEngine engine which supports amending order, the result is sent back by EventOrderAmend
+type OrderAmendEngine interface {
+	AmendOrder(id string, price, amount float64)
+}
+
+// OrderAmendHandler script which handles the result of amending order
+type OrderAmendHandler interface {
+	OnOrderAmend(amend *OrderAmend)
+}
+
+// OrderOptionEngine engine which supports order options, scripts can use it by type assertion
+type OrderOptionEngine interface {
+	DoOrderWithOption(typ TradeType, price, amount float64, opt OrderOption) string
+}
+
+// OrderGroupEngine engine which supports linked order groups, scripts can use it by type assertion
+type OrderGroupEngine interface {
+	// Bracket send entry order with take profit and stop loss orders, which work after entry is filled,
+	// take profit or stop loss is skipped if its price is 0
+	Bracket(entry TradeType, price, amount, takeProfit, stopLoss float64) (entryID, takeProfitID, stopLossID string)
+	// OCO send two orders with the same amount, one cancels the other
+	OCO(first TradeType, firstPrice float64, second TradeType, secondPrice float64, amount float64) (firstID, secondID string)
+}
+
+// TrailingStopEngine engine which supports trailing stop orders, scripts can use it by type assertion
+type TrailingStopEngine interface {
+	// TrailingStopLong stop of long position, the stop price follows the highest price by distance or percent
+	TrailingStopLong(distance, percent, amount float64) string
+	// TrailingStopShort stop of short position, the stop price follows the lowest price by distance or percent
+	TrailingStopShort(distance, percent, amount float64) string
+}
+
+// groupEpsilon leg is treated as finished if the remain amount is less than it
+const groupEpsilon = 1e-9
+
+// OrderGroup amounts of linked orders, the filled amount of a leg reduces all legs,
+// if the group has parent, legs are sized by the filled amount of parent
+type OrderGroup struct {
+	ID     string
+	Parent string
+
+	parentFilled float64
+	parentDone   bool
+	filled       float64
+	legs         map[string]float64
+}
+
+func NewOrderGroup(id, parent string) *OrderGroup {
+	return &OrderGroup{ID: id, Parent: parent, legs: make(map[string]float64)}
+}
+
+// AddLeg add leg with its amount
+func (g *OrderGroup) AddLeg(id string, amount float64) {
+	g.legs[id] = amount
+}
+
+// RemoveLeg remove canceled leg, the amount it filled still reduces other legs
+func (g *OrderGroup) RemoveLeg(id string) {
+	delete(g.legs, id)
+}
+
+// HasLeg return true if id is a leg of group
+func (g *OrderGroup) HasLeg(id string) bool {
+	_, ok := g.legs[id]
+	return ok
+}
+
+// Legs return ids of legs
+func (g *OrderGroup) Legs() (ids []string) {
+	for k := range g.legs {
+		ids = append(ids, k)
+	}
+	return
+}
+
+// Fill record the filled amount of parent or leg
+func (g *OrderGroup) Fill(id string, amount float64) {
+	if g.Parent != "" && id == g.Parent {
+		g.parentFilled += amount
+		return
+	}
+	if g.HasLeg(id) {
+		g.filled += amount
+	}
+}
+
+// SetParentDone parent is filled in full or canceled, it won't be filled any more
+func (g *OrderGroup) SetParentDone() {
+	g.parentDone = true
+}
+
+// Remain return the amount leg can be filled now
+func (g *OrderGroup) Remain(id string) float64 {
+	amount, ok := g.legs[id]
+	if !ok {
+		return 0
+	}
+	if g.Parent != "" {
+		amount = math.Min(amount, g.parentFilled)
+	}
+	return math.Max(0, amount-g.filled)
+}
+
+// Done return true if no leg can be filled any more
+func (g *OrderGroup) Done() bool {
+	if g.Parent != "" && !g.parentDone {
+		return false
+	}
+	for id := range g.legs {
+		if g.Remain(id) > groupEpsilon {
+			return false
+		}
+	}
+	return true
+}
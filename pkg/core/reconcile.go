@@ -0,0 +1,45 @@
+package core
+
+import (
+	"fmt"
+
+	. "github.com/ztrade/trademodel"
+)
+
+// ReconcilePolicy how the orders and positions found on exchange at start are handled
+type ReconcilePolicy string
+
+const (
+	// ReconcileAdopt track the open orders and positions, scripts can cancel the orders by exchange order id
+	ReconcileAdopt ReconcilePolicy = "adopt"
+	// ReconcileCancel cancel the open orders and track the positions
+	ReconcileCancel ReconcilePolicy = "cancel"
+	// ReconcileFlatten cancel the open orders and close the positions with market orders
+	ReconcileFlatten ReconcilePolicy = "flatten"
+)
+
+// ParseReconcilePolicy parse policy: adopt,cancel,flatten, empty means adopt
+func ParseReconcilePolicy(str string) (p ReconcilePolicy, err error) {
+	p = ReconcilePolicy(str)
+	switch p {
+	case "":
+		p = ReconcileAdopt
+	case ReconcileAdopt, ReconcileCancel, ReconcileFlatten:
+	default:
+		err = fmt.Errorf("unsupport reconcile policy: %s", str)
+	}
+	return
+}
+
+// OpenOrder open order found on exchange, Action is the open or close direction of order,
+// which is told by exchange with reduce only flag or position side
+type OpenOrder struct {
+	Order
+	Action TradeType
+}
+
+// ReconcileExchange exchange which can fetch open orders and positions, used to reconcile on start
+type ReconcileExchange interface {
+	GetOpenOrders(symbol string) (orders []*OpenOrder, err error)
+	GetPositions(symbol string) (positions []*Position, err error)
+}
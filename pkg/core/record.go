@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+)
+
+const (
+	// RecordAction order action sent by strategy
+	RecordAction = "action"
+	// RecordOrder status update of order
+	RecordOrder = "order"
+	// RecordTrade trade of order
+	RecordTrade = "trade"
+)
+
+// TradeRecord order action, order status or trade of live trading stored in db
+type TradeRecord struct {
+	ID        int64     `xorm:"pk autoincr null 'id'"`
+	Start     int64     `xorm:"index 'start'"`       // unix second
+	Timestamp int64     `xorm:"notnull 'timestamp'"` // unix millisecond
+	Kind      string    `xorm:"notnull 'kind'"`
+	OrderID   string    `xorm:"index 'order_id'"` // local id of order
+	Action    TradeType `xorm:"'action'"`
+	Price     float64   `xorm:"'price'"`
+	Amount    float64   `xorm:"'amount'"`
+	Filled    float64   `xorm:"'filled'"`
+	Status    string    `xorm:"'status'"`
+	Side      string    `xorm:"'side'"`
+	Remark    string    `xorm:"'remark'"`
+	Table     string    `xorm:"-"`
+}
+
+func newTradeRecord(kind string, tm time.Time) *TradeRecord {
+	return &TradeRecord{Kind: kind, Start: tm.Unix(), Timestamp: tm.UnixMilli()}
+}
+
+// NewActionRecord create record of order action
+func NewActionRecord(act *TradeAction, tm time.Time) *TradeRecord {
+	r := newTradeRecord(RecordAction, tm)
+	r.OrderID, r.Action, r.Price, r.Amount = act.ID, act.Action, act.Price, act.Amount
+	return r
+}
+
+// NewOrderRecord create record of order status, Remark is the reason of reject or cancel
+func NewOrderRecord(update *OrderUpdate) *TradeRecord {
+	r := newTradeRecord(RecordOrder, update.Time)
+	act := update.Action
+	r.OrderID, r.Action, r.Price, r.Amount = act.ID, act.Action, act.Price, act.Amount
+	r.Filled, r.Status, r.Remark = update.Filled, string(update.Status), update.Reason
+	return r
+}
+
+// NewTradeRecord create record of trade
+func NewTradeRecord(tr *Trade) *TradeRecord {
+	r := newTradeRecord(RecordTrade, tr.Time)
+	r.OrderID, r.Action, r.Price, r.Amount = tr.ID, tr.Action, tr.Price, tr.Amount
+	r.Filled, r.Side, r.Remark = tr.Amount, tr.Side, tr.Remark
+	return r
+}
+
+func (r TradeRecord) TableName() string {
+	return r.Table
+}
+
+func (r TradeRecord) GetTable() string {
+	return r.Table
+}
+
+func (r TradeRecord) GetStart() int64 {
+	return r.Start
+}
+
+func (r *TradeRecord) SetTable(tbl string) {
+	r.Table = tbl
+}
+
+func (r TradeRecord) Time() time.Time {
+	return time.UnixMilli(r.Timestamp)
+}
+
+// Trade convert trade record to trade
+func (r TradeRecord) Trade() Trade {
+	return Trade{ID: r.OrderID, Action: r.Action, Time: r.Time(), Price: r.Price, Amount: r.Amount, Side: r.Side, Remark: r.Remark}
+}
+
+func (r TradeRecord) String() string {
+	return fmt.Sprintf("%s %s %s %s price:%f amount:%f filled:%f %s %s", r.Time().String(), r.Kind, r.OrderID, r.Action, r.Price, r.Amount, r.Filled, r.Status, r.Remark)
+}
@@ -10,6 +10,18 @@ func NewRiskLimits() (rl RiskLimits) {
 
 func (rl RiskLimits) Update(limit RiskLimit) {
 	rl[limit.Key()] = limit
+	// latest limit of code
+	rl[limit.Code] = limit
+}
+
+// Get return the latest limit of code, fallback to global limit
+func (rl RiskLimits) Get(code string) (limit RiskLimit, ok bool) {
+	limit, ok = rl[code]
+	if ok {
+		return
+	}
+	limit, ok = rl[""]
+	return
 }
 
 func (rl RiskLimits) GetLimitRatio(limit RiskLimit) (ret float64) {
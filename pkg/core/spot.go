@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/ztrade/base/common"
+	. "github.com/ztrade/trademodel"
+)
+
+// ErrSpotShort spot account can't sell more than it holds
+var ErrSpotShort = errors.New("spot account not support short")
+
+// spotEpsilon base amount less than it is treated as zero
+const spotEpsilon = 1e-12
+
+// SpotBalance balance of spot account with base and quote assets, position is the base asset held,
+// fee of buy is deducted from the base received and fee of sell is deducted from the quote received,
+// balance is valued in quote asset with the last price
+type SpotBalance struct {
+	quote float64
+	base  float64
+	// cost quote spent on the base held
+	cost     float64
+	fee      float64
+	feeTotal float64
+	price    float64
+}
+
+func NewSpotBalance() *SpotBalance {
+	return new(SpotBalance)
+}
+
+// Set set the quote balance, the base balance is cleared
+func (b *SpotBalance) Set(total float64) {
+	b.quote = total
+	b.base = 0
+	b.cost = 0
+}
+
+func (b *SpotBalance) SetFee(fee float64) {
+	b.fee = fee
+}
+
+// SetLever spot account has no lever
+func (b *SpotBalance) SetLever(lever float64) {
+}
+
+// SetPrice set the last price used to value the base asset
+func (b *SpotBalance) SetPrice(price float64) {
+	b.price = price
+}
+
+// Pos return the base asset held
+func (b *SpotBalance) Pos() float64 {
+	return b.base
+}
+
+// Quote return the quote asset held
+func (b *SpotBalance) Quote() float64 {
+	return b.quote
+}
+
+// Get return the total value in quote asset
+func (b *SpotBalance) Get() float64 {
+	return common.FloatAdd(b.quote, common.FloatMul(b.base, b.price))
+}
+
+func (b *SpotBalance) GetFeeTotal() float64 {
+	return b.feeTotal
+}
+
+// AddTrade buy with quote or sell the base held, profit of sell is the quote received minus the cost of base sold
+func (b *SpotBalance) AddTrade(tr Trade) (profit, onceFee float64, err error) {
+	if tr.Amount <= 0 {
+		return
+	}
+	value := common.FloatMul(tr.Amount, tr.Price)
+	onceFee = common.FloatMul(value, b.fee)
+	if tr.Action.IsLong() {
+		if !tr.Action.IsOpen() {
+			err = ErrSpotShort
+			return
+		}
+		if value > b.quote {
+			err = common.ErrNoBalance
+			return
+		}
+		b.quote = common.FloatSub(b.quote, value)
+		b.base = common.FloatAdd(b.base, common.FloatMul(tr.Amount, 1-b.fee))
+		b.cost = common.FloatAdd(b.cost, value)
+	} else {
+		if tr.Action.IsOpen() || tr.Amount > b.base+spotEpsilon {
+			err = ErrSpotShort
+			return
+		}
+		basis := b.cost * tr.Amount / b.base
+		received := common.FloatSub(value, onceFee)
+		profit = common.FloatSub(received, basis)
+		b.quote = common.FloatAdd(b.quote, received)
+		b.base = common.FloatSub(b.base, tr.Amount)
+		b.cost = common.FloatSub(b.cost, basis)
+		if b.base <= spotEpsilon {
+			b.base = 0
+			b.cost = 0
+		}
+	}
+	b.feeTotal = common.FloatAdd(b.feeTotal, onceFee)
+	b.price = tr.Price
+	return
+}
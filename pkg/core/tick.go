@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+)
+
+// TradeTick market trade stored in db
+type TradeTick struct {
+	ID        int64   `xorm:"pk autoincr null 'id'"`
+	Start     int64   `xorm:"index 'start'"`       // unix second
+	Timestamp int64   `xorm:"notnull 'timestamp'"` // unix millisecond
+	TradeID   string  `xorm:"unique 'trade_id'"`
+	Price     float64 `xorm:"notnull 'price'"`
+	Amount    float64 `xorm:"notnull 'amount'"`
+	Side      string  `xorm:"'side'"`
+	Table     string  `xorm:"-"`
+}
+
+// NewTradeTick create tick from market trade
+func NewTradeTick(tr *Trade) *TradeTick {
+	t := &TradeTick{
+		Start:     tr.Time.Unix(),
+		Timestamp: tr.Time.UnixMilli(),
+		TradeID:   tr.ID,
+		Price:     tr.Price,
+		Amount:    tr.Amount,
+		Side:      tr.Side,
+	}
+	if t.TradeID == "" {
+		t.TradeID = fmt.Sprintf("%d-%s-%v-%v", t.Timestamp, t.Side, t.Price, t.Amount)
+	}
+	return t
+}
+
+func (t TradeTick) TableName() string {
+	return t.Table
+}
+
+func (t TradeTick) GetTable() string {
+	return t.Table
+}
+
+func (t TradeTick) GetStart() int64 {
+	return t.Start
+}
+
+func (t *TradeTick) SetTable(tbl string) {
+	t.Table = tbl
+}
+
+func (t TradeTick) Time() time.Time {
+	return time.UnixMilli(t.Timestamp)
+}
+
+// Trade convert to market trade
+func (t TradeTick) Trade() *Trade {
+	return &Trade{ID: t.TradeID, Time: t.Time(), Price: t.Price, Amount: t.Amount, Side: t.Side}
+}
+
+func (t TradeTick) String() string {
+	return fmt.Sprintf("%s %s price:%f amount:%f side:%s", t.Time().String(), t.TradeID, t.Price, t.Amount, t.Side)
+}
@@ -2,6 +2,8 @@ package ctl
 
 import (
 	"errors"
+	"fmt"
+	"path"
 	"sync"
 	"time"
 
@@ -9,6 +11,7 @@ import (
 	. "github.com/ztrade/ztrade/pkg/core"
 	"github.com/ztrade/ztrade/pkg/event"
 	"github.com/ztrade/ztrade/pkg/process/dbstore"
+	"github.com/ztrade/ztrade/pkg/process/risk"
 	"github.com/ztrade/ztrade/pkg/process/rpt"
 	"github.com/ztrade/ztrade/pkg/process/vex"
 
@@ -17,21 +20,35 @@ import (
 )
 
 type Backtest struct {
-	progress    int
-	exchange    string
-	symbol      string
-	paramData   string
-	start       time.Time
-	end         time.Time
-	running     bool
-	stop        chan bool
-	db          *dbstore.DBStore
-	scriptFile  string
-	rpt         rpt.Reporter
-	balanceInit float64
-	loadDBOnce  int
-	fee         float64
-	lever       float64
+	progress      int
+	exchange      string
+	symbol        string
+	symbols       []string
+	paramData     string
+	start         time.Time
+	end           time.Time
+	running       bool
+	stop          chan bool
+	db            *dbstore.DBStore
+	scriptFile    string
+	scripts       []string
+	rpt           rpt.Reporter
+	balanceInit   float64
+	loadDBOnce    int
+	fee           float64
+	lever         float64
+	riskLimit     *RiskLimit
+	slippage      vex.Slippage
+	path          vex.PricePath
+	mmr           float64
+	funding       time.Duration
+	tickMode      bool
+	bookMode      bool
+	participation float64
+	latency       vex.Latency
+	spot          bool
+	hedge         bool
+	fees          *FeeSchedule
 
 	closeAllWhenFinished bool
 }
@@ -63,14 +80,90 @@ func (b *Backtest) SetBalanceInit(balanceInit, fee float64) {
 	b.fee = fee
 }
 
+// SetFees charge maker and taker fee rates instead of the fee set by SetBalanceInit
+func (b *Backtest) SetFees(fees *FeeSchedule) {
+	b.fees = fees
+}
+
 func (b *Backtest) SetLever(lever float64) {
 	b.lever = lever
 }
 
+// SetRiskLimit enable risk manager with limit, Lever of limit is replaced by SetLever
+func (b *Backtest) SetRiskLimit(limit RiskLimit) {
+	b.riskLimit = &limit
+}
+
+// SetSlippage set the slippage model of market and stop orders
+func (b *Backtest) SetSlippage(slippage vex.Slippage) {
+	b.slippage = slippage
+}
+
+// SetPricePath set the price path model inside candle
+func (b *Backtest) SetPricePath(path vex.PricePath) {
+	b.path = path
+}
+
+// SetTickMode backtest with market trade ticks in db, 1m candles are synthesized from ticks
+func (b *Backtest) SetTickMode(tickMode bool) {
+	b.tickMode = tickMode
+}
+
+// SetBookMode backtest with depth snapshots and market trade ticks in db,
+// limit orders are matched with order book and estimated queue position
+func (b *Backtest) SetBookMode(bookMode bool) {
+	b.bookMode = bookMode
+}
+
+// SetParticipation limit the fill amount of order in one candle to rate * volume of candle
+func (b *Backtest) SetParticipation(rate float64) {
+	b.participation = rate
+}
+
+// SetLatency delay orders, cancels and amends sent to virtual exchange by latency model
+func (b *Backtest) SetLatency(latency vex.Latency) {
+	b.latency = latency
+}
+
+// SetSpot backtest with spot account, lever and short orders are not supported
+func (b *Backtest) SetSpot(spot bool) {
+	b.spot = spot
+}
+
+// SetHedge backtest with hedge mode account, long and short positions are held independently,
+// lever must be 1 because legs are never liquidated
+func (b *Backtest) SetHedge(hedge bool) {
+	b.hedge = hedge
+}
+
+// SetMaintenanceMargin set the maintenance margin rate used to calculate liquidation price
+func (b *Backtest) SetMaintenanceMargin(rate float64) {
+	b.mmr = rate
+}
+
+// SetFunding settle funding every interval with funding rates in db, 0 means disabled
+func (b *Backtest) SetFunding(interval time.Duration) {
+	b.funding = interval
+}
+
 func (b *Backtest) SetScript(scriptFile string) {
 	b.scriptFile = scriptFile
 }
 
+// AddScript add script which runs with the script set by SetScript
+func (b *Backtest) AddScript(scriptFile string) {
+	b.scripts = append(b.scripts, scriptFile)
+}
+
+// SetSymbols backtest many symbols in one portfolio, candles of all symbols are merged in time order,
+// every symbol has its own position and scripts, and all symbols share one margin balance
+func (b *Backtest) SetSymbols(symbols []string) {
+	b.symbols = symbols
+	if len(symbols) > 0 {
+		b.symbol = symbols[0]
+	}
+}
+
 func (b *Backtest) SetReporter(rpt rpt.Reporter) {
 	b.rpt = rpt
 }
@@ -88,6 +181,50 @@ func (b *Backtest) Stop() (err error) {
 	return
 }
 
+// newVExchange create virtual exchange of symbol
+func (b *Backtest) newVExchange(symbol string) (ex *vex.VExchange, err error) {
+	ex = vex.NewVExchange(symbol)
+	ex.SetSpot(b.spot)
+	ex.SetHedge(b.hedge)
+	ex.SetTickMode(b.tickMode)
+	ex.SetBookMode(b.bookMode)
+	ex.SetSlippage(b.slippage)
+	if b.path != "" {
+		ex.SetPricePath(b.path)
+	}
+	ex.SetMaintenanceMargin(b.mmr)
+	ex.SetParticipation(b.participation)
+	ex.SetLatency(b.latency)
+	if b.funding > 0 {
+		fundingTbl := b.db.GetFundingTbl(b.exchange, symbol)
+		// load the rate before start
+		rates, err := fundingTbl.GetFundingRates(b.start.Add(-b.funding), b.end)
+		if err != nil {
+			return nil, err
+		}
+		if len(rates) == 0 {
+			log.Warnf("no funding rates found of %s %s, download them first", b.exchange, symbol)
+		}
+		ex.SetFunding(b.funding, rates)
+	}
+	return
+}
+
+// newScript create script engine of symbol with all scripts
+func (b *Backtest) newScript(symbol string) (engine Scripter, err error) {
+	engine, err = NewScript(b.scriptFile, b.paramData, symbol)
+	if err != nil {
+		return
+	}
+	for _, v := range b.scripts {
+		err = engine.AddScript(path.Base(v), v, b.paramData)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 // Run !TODO need support multi binsizes
 func (b *Backtest) Run() (err error) {
 	defer func() {
@@ -96,21 +233,94 @@ func (b *Backtest) Run() (err error) {
 	closeCh := make(chan bool)
 	param := event.NewBaseProcesser("param")
 	bSize := "1m"
-	tbl := b.db.NewKlineTbl(b.exchange, b.symbol, bSize)
-	tbl.SetLoadOnce(b.loadDBOnce)
-	tbl.SetLoadDataMode(true)
-	tbl.SetCloseCh(closeCh)
-	ex := vex.NewVExchange(b.symbol)
-	engine, err := NewScript(b.scriptFile, b.paramData, b.symbol)
-	if err != nil {
+	symbols := b.symbols
+	if len(symbols) == 0 {
+		symbols = []string{b.symbol}
+	}
+	portfolio := len(symbols) > 1
+	if b.hedge && b.lever > 1 {
+		// liquidation price is calculated from net position, legs of hedge mode can't be liquidated
+		err = fmt.Errorf("hedge mode not support lever %f, liquidation of legs isn't simulated", b.lever)
 		return
 	}
+	var tbl event.Processer
+	if portfolio {
+		if b.bookMode || b.tickMode {
+			err = fmt.Errorf("tick and book mode not support many symbols")
+			return
+		}
+		klineTbls := b.db.NewKlineTbls(b.exchange, symbols, bSize)
+		klineTbls.SetLoadOnce(b.loadDBOnce)
+		klineTbls.SetCloseCh(closeCh)
+		tbl = klineTbls
+	} else if b.bookMode {
+		depthTbl := b.db.NewDepthTbl(b.exchange, b.symbol)
+		depthTbl.SetLoadOnce(b.loadDBOnce)
+		depthTbl.SetLoadDataMode(true)
+		depthTbl.SetTickTbl(b.db.NewTickTbl(b.exchange, b.symbol))
+		depthTbl.SetCloseCh(closeCh)
+		tbl = depthTbl
+	} else if b.tickMode {
+		tickTbl := b.db.NewTickTbl(b.exchange, b.symbol)
+		tickTbl.SetLoadOnce(b.loadDBOnce)
+		tickTbl.SetLoadDataMode(true)
+		tickTbl.SetCloseCh(closeCh)
+		tbl = tickTbl
+	} else {
+		klineTbl := b.db.NewKlineTbl(b.exchange, b.symbol, bSize)
+		klineTbl.SetLoadOnce(b.loadDBOnce)
+		klineTbl.SetLoadDataMode(true)
+		klineTbl.SetCloseCh(closeCh)
+		tbl = klineTbl
+	}
+	var account *vex.Account
+	if portfolio {
+		// all symbols share one margin balance
+		account = vex.NewAccount()
+	}
+	var exs []*vex.VExchange
+	var engines []event.Processer
+	for _, symbol := range symbols {
+		ex, err := b.newVExchange(symbol)
+		if err != nil {
+			return err
+		}
+		if account != nil {
+			ex.SetAccount(account)
+		}
+		exs = append(exs, ex)
+		engine, err := b.newScript(symbol)
+		if err != nil {
+			return err
+		}
+		engines = append(engines, engine)
+	}
+	if sr, ok := b.rpt.(rpt.SpotReporter); ok {
+		sr.SetSpot(b.spot)
+	}
+	if hr, ok := b.rpt.(rpt.HedgeReporter); ok {
+		hr.SetHedge(b.hedge)
+	}
 	r := rpt.NewRpt(b.rpt)
 	processers := event.NewSyncProcessers()
+	processers.SetClock(NewVirtualClock())
 	processers.Add(param)
 	processers.Add(tbl)
-	processers.Add(ex)
-	processers.Add(engine)
+	riskLimit := RiskLimit{Lever: b.lever}
+	if b.riskLimit != nil {
+		riskLimit = *b.riskLimit
+		riskLimit.Lever = b.lever
+		// risk must be added before exchange to intercept orders
+		for _, symbol := range symbols {
+			processers.Add(risk.NewRisk(symbol))
+		}
+	}
+	for _, ex := range exs {
+		processers.Add(ex)
+	}
+	for _, engine := range engines {
+		processers.Add(engine)
+	}
 	processers.Add(r)
 
 	var stopOnce sync.Once
@@ -130,8 +340,8 @@ func (b *Backtest) Run() (err error) {
 		return
 	}
 
-	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: b.balanceInit, Fee: b.fee})
-	param.Send("risk_init", EventRiskLimit, &RiskLimit{Lever: b.lever})
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: b.balanceInit, Fee: b.fee, Fees: b.fees})
+	param.Send("risk_init", EventRiskLimit, &riskLimit)
 	candleParam := CandleParam{
 		Start:   b.start,
 		End:     b.end,
@@ -139,8 +349,16 @@ func (b *Backtest) Run() (err error) {
 		BinSize: bSize,
 	}
 
-	log.Info("backtest candle param:", candleParam)
-	param.Send("load_candle", EventWatch, NewWatchCandle(&candleParam))
+	if b.bookMode {
+		log.Info("backtest depth param:", candleParam)
+		param.Send("load_depth", EventWatch, &WatchParam{Type: EventDepth, Data: &candleParam, Extra: b.symbol})
+	} else if b.tickMode {
+		log.Info("backtest tick param:", candleParam)
+		param.Send("load_tick", EventWatch, &WatchParam{Type: EventTradeMarket, Data: &candleParam, Extra: b.symbol})
+	} else {
+		log.Info("backtest candle param:", candleParam)
+		param.Send("load_candle", EventWatch, NewWatchCandle(&candleParam))
+	}
 	// TODO wait for finish
 	select {
 	case <-closeCh:
@@ -149,7 +367,9 @@ func (b *Backtest) Run() (err error) {
 	}
 	if b.closeAllWhenFinished {
 		time.Sleep(time.Second * 10)
-		ex.CloseAll()
+		for _, ex := range exs {
+			ex.CloseAll()
+		}
 	}
 	processers.WaitClose(time.Second * 10)
 	return
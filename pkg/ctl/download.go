@@ -5,10 +5,12 @@ import (
 	"time"
 
 	// . "github.com/ztrade/ztrade/pkg/define"
+	. "github.com/ztrade/ztrade/pkg/core"
 
 	"github.com/ztrade/exchange"
 	"github.com/ztrade/trademodel"
 	"github.com/ztrade/ztrade/pkg/process/dbstore"
+	"github.com/ztrade/ztrade/pkg/process/exchange/binance"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -26,6 +28,7 @@ type DataDownload struct {
 	db       *dbstore.DBStore
 	cfg      *viper.Viper
 	isAuto   bool
+	funding  bool
 }
 
 // NewDataDownload constructor of DataDownload
@@ -57,6 +60,11 @@ func (d *DataDownload) SetBinSize(binSize string) {
 	d.binSize = binSize
 }
 
+// SetFunding download funding rates instead of candles
+func (d *DataDownload) SetFunding(bFunding bool) {
+	d.funding = bFunding
+}
+
 // Start start backtest
 func (d *DataDownload) Start() (err error) {
 	d.running = true
@@ -70,11 +78,14 @@ func (d *DataDownload) Stop() (err error) {
 	return
 }
 func (d *DataDownload) AutoRun() (err error) {
-	tbl := d.db.GetKlineTbl(d.exchange, d.symbol, d.binSize)
 	var invalidTime time.Time
 	var tmTemp, start time.Time
 	start = time.Now()
-	tmTemp = tbl.GetNewest()
+	if d.funding {
+		tmTemp = d.db.GetFundingTbl(d.exchange, d.symbol).GetNewest()
+	} else {
+		tmTemp = d.db.GetKlineTbl(d.exchange, d.symbol, d.binSize).GetNewest()
+	}
 	if tmTemp == invalidTime {
 		err = fmt.Errorf("no start found in db,you must set start time")
 		return
@@ -100,13 +111,21 @@ func (d *DataDownload) Run() (err error) {
 }
 
 func (d *DataDownload) download(start, end time.Time) (err error) {
-	log.Info("begin download candle:", start, end, d.symbol, d.binSize)
 	exchangeType := viper.GetString(fmt.Sprintf("exchanges.%s.type", d.exchange))
 	fmt.Println(d.exchange, exchangeType)
 	ex, err := exchange.NewExchange(exchangeType, exchange.WrapViper(d.cfg), d.exchange)
 	if err != nil {
 		return
 	}
+	if d.funding {
+		ex, err = binance.Extend(ex, exchange.WrapViper(d.cfg), d.exchange)
+		if err != nil {
+			return
+		}
+		err = d.downloadFunding(ex, start, end)
+		return
+	}
+	log.Info("begin download candle:", start, end, d.symbol, d.binSize)
 	tbl := d.db.GetKlineTbl(d.exchange, d.symbol, d.binSize)
 	klines, errChan := exchange.KlineChan(ex, d.symbol, d.binSize, start, end)
 	var t time.Time
@@ -152,6 +171,32 @@ func (d *DataDownload) download(start, end time.Time) (err error) {
 	return
 }
 
+func (d *DataDownload) downloadFunding(ex exchange.Exchange, start, end time.Time) (err error) {
+	log.Info("begin download funding rate:", start, end, d.symbol)
+	fetcher, ok := ex.(FundingRateFetcher)
+	if !ok {
+		err = fmt.Errorf("exchange %s not support funding rate", d.exchange)
+		return
+	}
+	rates, err := fetcher.GetFundingRates(d.symbol, start, end)
+	if err != nil {
+		return
+	}
+	if len(rates) == 0 {
+		return
+	}
+	datas := make([]interface{}, len(rates))
+	for k, v := range rates {
+		datas[k] = v
+	}
+	err = d.db.GetFundingTbl(d.exchange, d.symbol).WriteDatas(datas)
+	if err != nil {
+		return
+	}
+	fmt.Printf("write funding rates %s - %s success\n", rates[0].Time(), rates[len(rates)-1].Time())
+	return
+}
+
 // Progress return the progress of current backtest
 func (d *DataDownload) Progress() (progress int) {
 	return d.Progress()
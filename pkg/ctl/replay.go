@@ -0,0 +1,80 @@
+package ctl
+
+import (
+	"time"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+	"github.com/ztrade/ztrade/pkg/event"
+	"github.com/ztrade/ztrade/pkg/process/replay"
+	"github.com/ztrade/ztrade/pkg/process/rpt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Replay replay a journal recorded by Trade against script
+type Replay struct {
+	journal    string
+	symbol     string
+	paramData  string
+	scriptFile string
+	rpt        rpt.Reporter
+	running    bool
+}
+
+// NewReplay constructor of Replay
+func NewReplay(journal, symbol, param string) (r *Replay, err error) {
+	r = new(Replay)
+	r.journal = journal
+	r.symbol = symbol
+	r.paramData = param
+	return
+}
+
+func (r *Replay) SetScript(scriptFile string) {
+	r.scriptFile = scriptFile
+}
+
+func (r *Replay) SetReporter(rpt rpt.Reporter) {
+	r.rpt = rpt
+}
+
+// Run replay all events in journal and wait for finish
+func (r *Replay) Run() (err error) {
+	r.running = true
+	defer func() {
+		r.running = false
+	}()
+	closeCh := make(chan bool)
+	param := event.NewBaseProcesser("param")
+	rp := replay.NewReplay(r.journal)
+	rp.SetCloseCh(closeCh)
+	engine, err := NewScript(r.scriptFile, r.paramData, r.symbol)
+	if err != nil {
+		return
+	}
+	processers := event.NewSyncProcessers()
+	processers.SetClock(NewVirtualClock())
+	processers.Add(param)
+	processers.Add(rp)
+	processers.Add(engine)
+	if r.rpt != nil {
+		processers.Add(rpt.NewRpt(r.rpt))
+	}
+	processers.SetErrorCallback(func(err error) {
+		log.Error("replay got error:", err.Error())
+	})
+	err = processers.Start()
+	if err != nil {
+		return
+	}
+	log.Info("replay journal:", r.journal)
+	param.Send("replay", EventWatch, &WatchParam{Type: "replay", Extra: r.symbol})
+	<-closeCh
+	processers.WaitClose(time.Second * 10)
+	return
+}
+
+// IsRunning return if the replay is running
+func (r *Replay) IsRunning() (ret bool) {
+	return r.running
+}
@@ -9,10 +9,13 @@ import (
 	zexchange "github.com/ztrade/exchange"
 	. "github.com/ztrade/ztrade/pkg/core"
 	"github.com/ztrade/ztrade/pkg/event"
+	"github.com/ztrade/ztrade/pkg/process/dbstore"
 	"github.com/ztrade/ztrade/pkg/process/exchange"
 	"github.com/ztrade/ztrade/pkg/process/goscript"
 	"github.com/ztrade/ztrade/pkg/process/notify"
+	"github.com/ztrade/ztrade/pkg/process/risk"
 	"github.com/ztrade/ztrade/pkg/process/rpt"
+	"github.com/ztrade/ztrade/pkg/process/vex"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -37,6 +40,13 @@ type Trade struct {
 	engine       *goscript.GoEngine
 	wg           sync.WaitGroup
 	loadRecent   time.Duration
+	journalFile  string
+	journal      *event.Journal
+	recordDB     *dbstore.DBStore
+	tradeDB      *dbstore.DBStore
+	paper        bool
+	balanceInit  float64
+	fee          float64
 }
 
 // NewTrade constructor of Trade
@@ -51,6 +61,7 @@ func NewTrade(exchange, symbol string) (b *Trade, err error) {
 	}
 	b.engine = gEngine
 	b.loadRecent = time.Hour * 24
+	b.balanceInit = 100000
 	return
 }
 
@@ -58,6 +69,32 @@ func (b *Trade) SetLoadRecent(recent time.Duration) {
 	b.loadRecent = recent
 }
 
+// SetJournal record all events to journal file, which can be replayed by Replay
+func (b *Trade) SetJournal(journalFile string) {
+	b.journalFile = journalFile
+}
+
+// SetRecordDB record market trades to db, which can be used by tick backtest
+func (b *Trade) SetRecordDB(db *dbstore.DBStore) {
+	b.recordDB = db
+}
+
+// SetTradeDB save order actions, order status and trades to db, which can be analyzed by report later
+func (b *Trade) SetTradeDB(db *dbstore.DBStore) {
+	b.tradeDB = db
+}
+
+// SetPaper trade with market data of exchange, but orders are filled by virtual exchange
+func (b *Trade) SetPaper(paper bool) {
+	b.paper = paper
+}
+
+// SetBalanceInit set the balance and fee of virtual exchange in paper mode
+func (b *Trade) SetBalanceInit(balanceInit, fee float64) {
+	b.balanceInit = balanceInit
+	b.fee = fee
+}
+
 func (b *Trade) SetStatusCh(ch chan *goscript.Status) {
 	b.engine.SetStatusCh(ch)
 }
@@ -121,7 +158,42 @@ func (b *Trade) init() (err error) {
 		err = nil
 	}
 	b.proc = event.NewProcessers()
-	procs := []event.Processer{param, ex, b.engine}
+	if b.journalFile != "" {
+		b.journal, err = event.NewJournal(b.journalFile)
+		if err != nil {
+			err = fmt.Errorf("open journal %s failed:%s", b.journalFile, err.Error())
+			return
+		}
+		b.proc.SetJournal(b.journal)
+	}
+	var riskLimit RiskLimit
+	err = cfg.UnmarshalKey("risk", &riskLimit)
+	if err != nil {
+		err = fmt.Errorf("parse risk config failed:%s", err.Error())
+		return
+	}
+	procs := []event.Processer{param}
+	if b.tradeDB != nil {
+		// added before risk to record the orders rejected by risk
+		procs = append(procs, b.tradeDB.NewTradeTbl(b.exchangeName, b.symbol))
+	}
+	bRisk := riskLimit != RiskLimit{}
+	if bRisk {
+		// risk must be added before exchange to intercept orders
+		procs = append(procs, risk.NewRisk(b.symbol))
+	}
+	procs = append(procs, ex)
+	if b.paper {
+		ex.UsePaperMode(true)
+		// orders are matched with realtime market trades
+		vexchange := vex.NewVExchange(b.symbol)
+		vexchange.SetTickMode(true)
+		procs = append(procs, vexchange)
+	}
+	procs = append(procs, b.engine)
+	if b.recordDB != nil {
+		procs = append(procs, b.recordDB.NewTickTbl(b.exchangeName, b.symbol), b.recordDB.NewDepthTbl(b.exchangeName, b.symbol))
+	}
 	if notify != nil {
 		procs = append(procs, notify)
 	}
@@ -140,6 +212,14 @@ func (b *Trade) init() (err error) {
 		log.Error("start processers error:", err.Error())
 		return
 	}
+	if b.paper {
+		log.Infof("paper trade balance: %f, fee: %f", b.balanceInit, b.fee)
+		param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: b.balanceInit, Fee: b.fee})
+	}
+	if bRisk {
+		log.Info("real trade risk limit:", riskLimit)
+		param.Send("risk_init", EventRiskLimit, &riskLimit)
+	}
 	candleParam := CandleParam{
 		Start:   time.Now().Add(-1 * b.loadRecent),
 		Symbol:  b.symbol,
@@ -165,5 +245,8 @@ func (b *Trade) Run() (err error) {
 	// TODO wait for finish
 	<-b.stop
 	b.proc.WaitClose(time.Second * 10)
+	if b.journal != nil {
+		err = b.journal.Close()
+	}
 	return
 }
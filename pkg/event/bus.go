@@ -1,18 +1,27 @@
 package event
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/ztrade/base/common"
+	"github.com/ztrade/trademodel"
+	"github.com/ztrade/ztrade/pkg/core"
 
 	log "github.com/sirupsen/logrus"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+var (
+	// ErrStopPropagation return by ProcessCall to stop passing event to the rest subscribers
+	ErrStopPropagation = errors.New("stop propagation")
+)
+
 // ProcessCall callback to process event
 type ProcessCall func(e *Event) error
 
@@ -33,6 +42,9 @@ type Bus struct {
 	processEvent  int64
 	lastEventTime time.Time
 	routines      int32
+
+	journal *Journal
+	clock   core.Clock
 }
 
 func NewBus(cache int) *Bus {
@@ -40,6 +52,7 @@ func NewBus(cache int) *Bus {
 	b.cache = cache
 	b.chs = make(map[string]chan *Event)
 	b.procs = make(map[string]ProcessList)
+	b.clock = core.NewWallClock()
 	return b
 }
 
@@ -48,9 +61,62 @@ func NewSyncBus() *Bus {
 	b.syncMode = true
 	b.chs = make(map[string]chan *Event)
 	b.procs = make(map[string]ProcessList)
+	b.clock = core.NewWallClock()
 	return b
 }
 
+// SetClock set the clock used to stamp events
+func (b *Bus) SetClock(clock core.Clock) {
+	b.clock = clock
+}
+
+// Now return current time of bus clock
+func (b *Bus) Now() time.Time {
+	return b.clock.Now()
+}
+
+// updateTime stamp event with bus clock,
+// clock which implements ClockUpdater is driven by candles, market trades or the time of replayed events
+func (b *Bus) updateTime(e *Event) {
+	updater, isUpdater := b.clock.(core.ClockUpdater)
+	if !e.Time.IsZero() {
+		if isUpdater {
+			updater.Update(e.Time)
+		}
+		return
+	}
+	if isUpdater {
+		switch e.GetType() {
+		case core.EventCandle:
+			candle, ok := e.GetData().(*trademodel.Candle)
+			binSize, _ := e.GetExtra().(string)
+			if ok {
+				dur, err := common.GetBinSizeDuration(binSize)
+				if err != nil {
+					dur = 0
+				}
+				updater.Update(candle.Time().Add(dur))
+			}
+		case core.EventTradeMarket:
+			trade, ok := e.GetData().(*trademodel.Trade)
+			if ok {
+				updater.Update(trade.Time)
+			}
+		case core.EventDepth:
+			depth, ok := e.GetData().(*trademodel.Depth)
+			if ok && !depth.UpdateTime.IsZero() {
+				updater.Update(depth.UpdateTime)
+			}
+		}
+	}
+	e.Time = b.clock.Now()
+}
+
+// SetJournal record all events send to bus to journal
+func (b *Bus) SetJournal(j *Journal) {
+	b.journal = j
+}
+
 func (b *Bus) runProc(sub string, ch chan *Event) (err error) {
 	atomic.AddInt32(&b.routines, 1)
 	defer atomic.AddInt32(&b.routines, -1)
@@ -67,6 +133,9 @@ func (b *Bus) runProc(sub string, ch chan *Event) (err error) {
 		for _, p := range procs {
 			err = p.Cb(e)
 			if err != nil {
+				if errors.Is(err, ErrStopPropagation) {
+					break
+				}
 				b.Send(NewErrorEvent(p.Name, err.Error(), err))
 				// log.Errorf("process %s error: %s", sub, err.Error())
 				continue
@@ -94,6 +163,14 @@ func (b *Bus) Subscribe(from, sub string, cb ProcessCall) (err error) {
 
 func (b *Bus) Send(e *Event) (err error) {
 	typ := e.GetType()
+	b.updateTime(e)
+	if b.journal != nil {
+		err = b.journal.Write(e)
+		if err != nil {
+			log.Errorf("Bus write %s event to journal failed: %s", typ, err.Error())
+			err = nil
+		}
+	}
 	procs, ok := b.procs[typ]
 	if !ok {
 		log.Warnf("Send %s event,but no subscribers, skip", e.GetType())
@@ -113,6 +190,10 @@ func (b *Bus) sendSync(procs ProcessList, e *Event) (err error) {
 	for _, p := range procs {
 		err = p.Cb(e)
 		if err != nil {
+			if errors.Is(err, ErrStopPropagation) {
+				err = nil
+				break
+			}
 			// log.Errorf("subscribe %s process error: %s", e.GetType(), err.Error())
 			b.Send(NewErrorEvent(p.Name, err.Error(), err))
 			continue
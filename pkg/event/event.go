@@ -2,6 +2,7 @@ package event
 
 import (
 	"sync"
+	"time"
 
 	"github.com/ztrade/ztrade/pkg/core"
 )
@@ -16,8 +17,10 @@ var (
 type Event struct {
 	Data core.EventData
 	Name string
-	// Time time.Time
+	Time time.Time
 	From string
+	// Symbol the symbol of event data, empty means all symbols
+	Symbol string
 }
 
 func NewErrorEvent(from, msg string, err error) *Event {
@@ -26,7 +29,6 @@ func NewErrorEvent(from, msg string, err error) *Event {
 	e.Data.Type = core.EventError
 	e.Data.Data = err
 	e.From = from
-	// e.Time = time.Now()
 	return e
 }
 
@@ -37,7 +39,6 @@ func NewEvent(name, strType, from string, data interface{}, extra interface{}) *
 	e.Data.Type = strType
 	e.From = from
 	e.Data.Data = data
-	// e.Time = time.Now()
 	e.Data.Extra = extra
 	return e
 }
@@ -45,6 +46,8 @@ func NewEvent(name, strType, from string, data interface{}, extra interface{}) *
 func releaseEvent(e *Event) {
 	e.Data.Data = nil
 	e.Data.Extra = nil
+	e.Time = time.Time{}
+	e.Symbol = ""
 	eventPool.Put(e)
 }
 
@@ -56,9 +59,9 @@ func (e *Event) GetType() string {
 	return e.Data.Type
 }
 
-// func (e *Event) GetTime() time.Time {
-// 	return e.Time
-// }
+func (e *Event) GetTime() time.Time {
+	return e.Time
+}
 
 func (e *Event) GetFrom() string {
 	return e.From
@@ -2,7 +2,9 @@ package event
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ztrade/trademodel"
 	"github.com/ztrade/ztrade/pkg/core"
 )
 
@@ -19,3 +21,19 @@ func TestUnmarshalEvent(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 }
+
+func TestBusVirtualClock(t *testing.T) {
+	b := NewSyncBus()
+	b.SetClock(core.NewVirtualClock())
+	var eventTime time.Time
+	b.Subscribe("test", core.EventCandle, func(e *Event) error {
+		eventTime = e.GetTime()
+		return nil
+	})
+	candle := &trademodel.Candle{Start: 1600000000}
+	b.Send(NewEvent("candle", core.EventCandle, "test", candle, "1m"))
+	closeTime := candle.Time().Add(time.Minute)
+	if !eventTime.Equal(closeTime) || !b.Now().Equal(closeTime) {
+		t.Fatalf("virtual clock error, event time: %s, now: %s", eventTime, b.Now())
+	}
+}
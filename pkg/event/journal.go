@@ -0,0 +1,100 @@
+package event
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ztrade/ztrade/pkg/core"
+)
+
+// JournalRecord one event recorded in journal
+type JournalRecord struct {
+	Seq    int64
+	Time   time.Time
+	Name   string
+	From   string
+	Symbol string `json:",omitempty"`
+	Data   core.EventData
+}
+
+// Journal append-only event journal, one json record per line
+type Journal struct {
+	f     *os.File
+	enc   *jsoniter.Encoder
+	seq   int64
+	mutex sync.Mutex
+}
+
+// NewJournal open journal file, records are appended if the file exists
+func NewJournal(fPath string) (j *Journal, err error) {
+	f, err := os.OpenFile(fPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	j = new(Journal)
+	j.f = f
+	j.enc = json.NewEncoder(f)
+	return
+}
+
+// Write record event to journal
+func (j *Journal) Write(e *Event) (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.seq++
+	r := JournalRecord{Seq: j.seq, Time: e.Time, Name: e.Name, From: e.From, Symbol: e.Symbol, Data: e.Data}
+	err = j.enc.Encode(&r)
+	return
+}
+
+// Close close the journal file
+func (j *Journal) Close() (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	err = j.f.Close()
+	return
+}
+
+// ReadJournal read all records of journal file in order
+func ReadJournal(fPath string) (records chan *JournalRecord, errCh chan error) {
+	records = make(chan *JournalRecord, 1024)
+	errCh = make(chan error, 1)
+	go func() {
+		defer func() {
+			close(records)
+			close(errCh)
+		}()
+		f, err := os.Open(fPath)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		var line int
+		for scanner.Scan() {
+			line++
+			buf := scanner.Bytes()
+			if len(buf) == 0 {
+				continue
+			}
+			r := new(JournalRecord)
+			err = json.Unmarshal(buf, r)
+			if err != nil {
+				errCh <- fmt.Errorf("journal %s line %d decode failed: %w", fPath, line, err)
+				return
+			}
+			records <- r
+		}
+		err = scanner.Err()
+		if err != nil {
+			errCh <- err
+		}
+	}()
+	return
+}
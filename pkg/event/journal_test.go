@@ -0,0 +1,59 @@
+package event
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ztrade/trademodel"
+	"github.com/ztrade/ztrade/pkg/core"
+)
+
+func TestJournal(t *testing.T) {
+	fPath := filepath.Join(t.TempDir(), "journal.log")
+	j, err := NewJournal(fPath)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b := NewSyncBus()
+	b.SetJournal(j)
+	var n int
+	b.Subscribe("test", core.EventCandle, func(e *Event) error {
+		n++
+		return nil
+	})
+	b.Send(NewEvent("candle", core.EventCandle, "klinetbl", &trademodel.Candle{Start: 1, Close: 10}, "1m"))
+	e := NewEvent("BTCUSDT", core.EventPosition, "exchange", &trademodel.Position{Symbol: "BTCUSDT", Hold: 1}, nil)
+	e.Symbol = "BTCUSDT"
+	b.Send(e)
+	err = j.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("candle subscriber called %d times", n)
+	}
+
+	records, errCh := ReadJournal(fPath)
+	var rets []*JournalRecord
+	for v := range records {
+		rets = append(rets, v)
+	}
+	err = <-errCh
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(rets) != 2 {
+		t.Fatalf("journal records error: %d", len(rets))
+	}
+	candle, ok := rets[0].Data.Data.(*trademodel.Candle)
+	if !ok || candle.Close != 10 {
+		t.Fatalf("journal candle error: %#v", rets[0].Data.Data)
+	}
+	if rets[0].Data.Extra != "1m" || rets[0].From != "klinetbl" || rets[0].Seq != 1 {
+		t.Fatalf("journal record error: %#v", rets[0])
+	}
+	pos, ok := rets[1].Data.Data.(*trademodel.Position)
+	if !ok || pos.Hold != 1 || rets[1].Symbol != "BTCUSDT" {
+		t.Fatalf("journal position error: %#v %s", rets[1].Data.Data, rets[1].Symbol)
+	}
+}
@@ -1,5 +1,7 @@
 package event
 
+import "time"
+
 // Processer handler of event
 type Processer interface {
 	Init(*Bus) error
@@ -13,6 +15,8 @@ type Processer interface {
 type BaseProcesser struct {
 	Bus  *Bus
 	Name string
+	// Symbol events sent are marked with symbol, and only events of symbol are matched
+	Symbol string
 }
 
 // NewBaseProcesser constructor
@@ -30,12 +34,12 @@ func (b *BaseProcesser) Subscribe(sub string, cb ProcessCall) (err error) {
 
 // Send send event
 func (b *BaseProcesser) Send(name, strType string, data interface{}) {
-	b.Bus.Send(NewEvent(name, strType, b.Name, data, nil))
+	b.Bus.Send(b.newEvent(name, strType, data, nil))
 }
 
 // SendExtra send event with extra info
 func (b *BaseProcesser) SendWithExtra(name, strType string, data, extra interface{}) {
-	b.Bus.Send(NewEvent(name, strType, b.Name, data, extra))
+	b.Bus.Send(b.newEvent(name, strType, data, extra))
 }
 
 // Init call before start
@@ -59,7 +63,27 @@ func (b *BaseProcesser) GetName() string {
 	return b.Name
 }
 
+// Now return current time of bus clock
+func (b *BaseProcesser) Now() time.Time {
+	if b.Bus == nil {
+		return time.Now()
+	}
+	return b.Bus.Now()
+}
+
 // CreateEvent create new event
 func (b *BaseProcesser) CreateEvent(name, strType string, data interface{}) *Event {
-	return NewEvent(name, strType, b.Name, data, nil)
+	return b.newEvent(name, strType, data, nil)
+}
+
+func (b *BaseProcesser) newEvent(name, strType string, data, extra interface{}) *Event {
+	e := NewEvent(name, strType, b.Name, data, extra)
+	e.Symbol = b.Symbol
+	return e
+}
+
+// MatchSymbol return true if the event is of the symbol of processer,
+// events without symbol and processers without symbol match all
+func (b *BaseProcesser) MatchSymbol(e *Event) bool {
+	return b.Symbol == "" || e.Symbol == "" || e.Symbol == b.Symbol
 }
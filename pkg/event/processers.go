@@ -35,6 +35,16 @@ func (h *Processers) SetErrorCallback(fn ErrorCallback) {
 
 }
 
+// SetClock set the clock of processers
+func (h *Processers) SetClock(clock core.Clock) {
+	h.bus.SetClock(clock)
+}
+
+// SetJournal record all events of processers to journal
+func (h *Processers) SetJournal(j *Journal) {
+	h.bus.SetJournal(j)
+}
+
 func (h *Processers) onError(e *Event) error {
 	errInfo := e.Data.Data.(error)
 	if h.errorCb == nil {
@@ -112,6 +112,74 @@ func (dr *DBStore) NewKlineTbl(exchange, symbol, binSize string) *KlineTbl {
 	return t
 }
 
+// NewKlineTbls create kline tables of symbols which emit candles in time order
+func (dr *DBStore) NewKlineTbls(exchange string, symbols []string, binSize string) *KlineTbls {
+	return NewKlineTbls(dr, exchange, symbols, binSize)
+}
+
+// GetFundingTbl get funding rate table
+func (dr *DBStore) GetFundingTbl(exchange, symbol string) *FundingTbl {
+	key := fmt.Sprintf("%s_%s_funding", exchange, symbol)
+	v, ok := dr.tbls.Load(key)
+	if ok {
+		return v.(*FundingTbl)
+	}
+	t := NewFundingTbl(dr, exchange, symbol)
+	dr.tbls.Store(key, t)
+	return t
+}
+
+// GetTickTbl get market trade tick table
+func (dr *DBStore) GetTickTbl(exchange, symbol string) *TickTbl {
+	key := fmt.Sprintf("%s_%s_tick", exchange, symbol)
+	v, ok := dr.tbls.Load(key)
+	if ok {
+		return v.(*TickTbl)
+	}
+	t := NewTickTbl(dr, exchange, symbol)
+	dr.tbls.Store(key, t)
+	return t
+}
+
+func (dr *DBStore) NewTickTbl(exchange, symbol string) *TickTbl {
+	t := NewTickTbl(dr, exchange, symbol)
+	return t
+}
+
+// GetDepthTbl get order book snapshot table
+func (dr *DBStore) GetDepthTbl(exchange, symbol string) *DepthTbl {
+	key := fmt.Sprintf("%s_%s_depth", exchange, symbol)
+	v, ok := dr.tbls.Load(key)
+	if ok {
+		return v.(*DepthTbl)
+	}
+	t := NewDepthTbl(dr, exchange, symbol)
+	dr.tbls.Store(key, t)
+	return t
+}
+
+func (dr *DBStore) NewDepthTbl(exchange, symbol string) *DepthTbl {
+	t := NewDepthTbl(dr, exchange, symbol)
+	return t
+}
+
+// GetTradeTbl get journal table of live trading
+func (dr *DBStore) GetTradeTbl(exchange, symbol string) *TradeTbl {
+	key := fmt.Sprintf("%s_%s_trade", exchange, symbol)
+	v, ok := dr.tbls.Load(key)
+	if ok {
+		return v.(*TradeTbl)
+	}
+	t := NewTradeTbl(dr, exchange, symbol)
+	dr.tbls.Store(key, t)
+	return t
+}
+
+func (dr *DBStore) NewTradeTbl(exchange, symbol string) *TradeTbl {
+	t := NewTradeTbl(dr, exchange, symbol)
+	return t
+}
+
 func (d *DBStore) SetUseCache(useCache bool) {
 	d.useCache = useCache
 }
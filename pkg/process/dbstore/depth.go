@@ -0,0 +1,200 @@
+package dbstore
+
+import (
+	"fmt"
+	"sync"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// DepthTbl order book snapshot table
+type DepthTbl struct {
+	BaseProcesser
+	TimeTbl
+	loadData bool
+	ticks    *TickTbl
+
+	cache      []interface{}
+	cacheMutex sync.Mutex
+}
+
+func NewDepthTbl(db *DBStore, exchange, symbol string) (t *DepthTbl) {
+	t = new(DepthTbl)
+	tbl := NewTimeTbl(db, t, exchange, symbol, "depth", "")
+	t.TimeTbl = *tbl
+	t.BaseProcesser.Name = "depthtbl:" + t.table
+	return
+}
+
+func (tbl *DepthTbl) Sing() TimeData {
+	return new(DepthSnapshot)
+}
+
+func (tbl *DepthTbl) Slice() interface{} {
+	return &[]*DepthSnapshot{}
+}
+
+func (tbl *DepthTbl) GetSlice(data interface{}) (rets []interface{}) {
+	datas, ok := data.(*[]*DepthSnapshot)
+	if !ok {
+		log.Error("DepthTbl getslice error")
+		return
+	}
+	rets = make([]interface{}, len(*datas))
+	for k, v := range *datas {
+		rets[k] = v
+	}
+	return
+}
+
+// SetLoadDataMode emit depths from table if true, otherwise record depths to table
+func (tbl *DepthTbl) SetLoadDataMode(bLoad bool) {
+	tbl.loadData = bLoad
+}
+
+// SetTickTbl market trades of tick table are emitted with depths in time order when load data
+func (tbl *DepthTbl) SetTickTbl(ticks *TickTbl) {
+	tbl.ticks = ticks
+}
+
+func (tbl *DepthTbl) Init(bus *Bus) (err error) {
+	tbl.BaseProcesser.Init(bus)
+	if !tbl.loadData {
+		tbl.Subscribe(EventDepth, tbl.onEventDepth)
+	}
+	tbl.Subscribe(EventWatch, tbl.onEventWatch)
+	return
+}
+
+func (tbl *DepthTbl) Stop() (err error) {
+	err = tbl.flush()
+	return
+}
+
+// WriteData write one depth
+func (tbl *DepthTbl) WriteData(data interface{}) (err error) {
+	return tbl.WriteDatas([]interface{}{data})
+}
+
+// WriteDatas write depths, duplicated depths are ignored
+func (tbl *DepthTbl) WriteDatas(datas []interface{}) (err error) {
+	return writeIgnoreDuplicate(&tbl.TimeTbl, datas)
+}
+
+func (tbl *DepthTbl) flush() (err error) {
+	tbl.cacheMutex.Lock()
+	cache := tbl.cache
+	tbl.cache = nil
+	tbl.cacheMutex.Unlock()
+	if len(cache) == 0 {
+		return
+	}
+	err = tbl.WriteDatas(cache)
+	return
+}
+
+func (tbl *DepthTbl) onEventDepth(e *Event) (err error) {
+	depth, ok := e.GetData().(*Depth)
+	if !ok {
+		err = fmt.Errorf("DepthTbl depth type error: %#v", e.GetData())
+		return
+	}
+	if depth.UpdateTime.IsZero() {
+		return
+	}
+	tbl.cacheMutex.Lock()
+	tbl.cache = append(tbl.cache, NewDepthSnapshot(depth))
+	n := len(tbl.cache)
+	tbl.cacheMutex.Unlock()
+	if n >= 64 {
+		err = tbl.flush()
+	}
+	return
+}
+
+func (tbl *DepthTbl) onEventWatch(e *Event) (err error) {
+	wParam, ok := e.GetData().(*WatchParam)
+	if !ok {
+		err = fmt.Errorf("event not watch %s %#v", e.Name, e.Data)
+		return
+	}
+	if wParam.Type != EventDepth || !tbl.loadData {
+		return
+	}
+	param, _ := wParam.Data.(*CandleParam)
+	if param == nil {
+		err = fmt.Errorf("event not CandleParam %s %#v", e.Name, e.Data)
+		return
+	}
+	go tbl.emitDepths(*param)
+	return
+}
+
+// dataIter iterate datas of DataChan one by one
+type dataIter struct {
+	ch   chan []interface{}
+	buf  []interface{}
+	done bool
+}
+
+// peek return the current data, nil if no more datas
+func (it *dataIter) peek() TimeData {
+	var ok bool
+	for !it.done && len(it.buf) == 0 {
+		it.buf, ok = <-it.ch
+		it.done = !ok
+	}
+	if len(it.buf) == 0 {
+		return nil
+	}
+	return it.buf[0].(TimeData)
+}
+
+func (it *dataIter) next() {
+	it.buf = it.buf[1:]
+}
+
+// emitDepths emit depths in table, market trades of tick table are merged by time
+// and 1m candles are synthesized from trades
+func (tbl *DepthTbl) emitDepths(param CandleParam) {
+	depths, err := tbl.DataChan(param.Start, param.End, "depth")
+	if err != nil {
+		log.Error("DepthTbl get depths failed:", err.Error())
+		return
+	}
+	depthIter := &dataIter{ch: depths}
+	tickIter := &dataIter{done: true}
+	if tbl.ticks != nil {
+		tickIter.ch, err = tbl.ticks.DataChan(param.Start, param.End, "tick")
+		if err != nil {
+			log.Error("DepthTbl get ticks failed:", err.Error())
+			return
+		}
+		tickIter.done = false
+	}
+	var builder candleBuilder
+	for {
+		d, _ := depthIter.peek().(*DepthSnapshot)
+		t, _ := tickIter.peek().(*TradeTick)
+		if d == nil && t == nil {
+			break
+		}
+		if t != nil && (d == nil || t.Timestamp < d.Timestamp) {
+			builder.emit(&tbl.BaseProcesser, param.Symbol, t)
+			tickIter.next()
+			continue
+		}
+		tbl.Bus.WaitEmpty()
+		tbl.Send(param.Symbol, EventDepth, d.Depth())
+		depthIter.next()
+	}
+	builder.flush(&tbl.BaseProcesser)
+	if tbl.closeCh != nil {
+		log.Info("depth table emitDepths finished")
+		tbl.closeCh <- true
+	}
+}
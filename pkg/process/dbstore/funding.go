@@ -0,0 +1,55 @@
+package dbstore
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// FundingTbl funding rate data table
+type FundingTbl struct {
+	TimeTbl
+}
+
+func NewFundingTbl(db *DBStore, exchange, symbol string) (t *FundingTbl) {
+	t = new(FundingTbl)
+	tbl := NewTimeTbl(db, t, exchange, symbol, "funding", "")
+	t.TimeTbl = *tbl
+	return
+}
+
+func (tbl *FundingTbl) Sing() TimeData {
+	return new(FundingRate)
+}
+
+func (tbl *FundingTbl) Slice() interface{} {
+	return &[]*FundingRate{}
+}
+
+func (tbl *FundingTbl) GetSlice(data interface{}) (rets []interface{}) {
+	datas, ok := data.(*[]*FundingRate)
+	if !ok {
+		log.Error("FundingTbl getslice error")
+		return
+	}
+	rets = make([]interface{}, len(*datas))
+	for k, v := range *datas {
+		rets[k] = v
+	}
+	return
+}
+
+// GetFundingRates get all funding rates between start and end
+func (tbl *FundingTbl) GetFundingRates(start, end time.Time) (rates []*FundingRate, err error) {
+	datas, err := tbl.DataChan(start, end, "funding")
+	if err != nil {
+		return
+	}
+	for v := range datas {
+		for _, r := range v {
+			rates = append(rates, r.(*FundingRate))
+		}
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package dbstore
+
+import (
+	"fmt"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// KlineTbls kline tables of many symbols, candles of all symbols are emitted in time order
+// and marked with their symbols
+type KlineTbls struct {
+	BaseProcesser
+	tbls    []*KlineTbl
+	closeCh chan bool
+}
+
+func NewKlineTbls(db *DBStore, exchange string, symbols []string, binSize string) (t *KlineTbls) {
+	t = new(KlineTbls)
+	for _, v := range symbols {
+		t.tbls = append(t.tbls, NewKlineTbl(db, exchange, v, binSize))
+	}
+	t.BaseProcesser.Name = "klinetbls"
+	return
+}
+
+func (t *KlineTbls) SetLoadOnce(loadOnce int) {
+	for _, v := range t.tbls {
+		v.SetLoadOnce(loadOnce)
+	}
+}
+
+func (t *KlineTbls) SetCloseCh(closeCh chan bool) {
+	t.closeCh = closeCh
+}
+
+func (t *KlineTbls) Init(bus *Bus) (err error) {
+	t.BaseProcesser.Init(bus)
+	t.Subscribe(EventWatch, t.onEventCandleParam)
+	return
+}
+
+func (t *KlineTbls) onEventCandleParam(e *Event) (err error) {
+	wParam, ok := e.GetData().(*WatchParam)
+	if !ok {
+		err = fmt.Errorf("event not watch %s %#v", e.Name, e.Data)
+		return
+	}
+	candleParam, _ := wParam.Data.(*CandleParam)
+	if candleParam == nil {
+		err = fmt.Errorf("event not CandleParam %s %#v", e.Name, e.Data)
+		return
+	}
+	go t.emitCandles(*candleParam)
+	return
+}
+
+func (t *KlineTbls) emitCandles(param CandleParam) {
+	iters := make([]*dataIter, len(t.tbls))
+	for i, tbl := range t.tbls {
+		candles, err := tbl.DataChan(param.Start, param.End, param.BinSize)
+		if err != nil {
+			log.Errorf("KlineTbls get candles of %s failed: %s", tbl.GetSymbol(), err.Error())
+			return
+		}
+		iters[i] = &dataIter{ch: candles}
+	}
+	for {
+		var candle *Candle
+		n := -1
+		for i, it := range iters {
+			c, _ := it.peek().(*Candle)
+			if c != nil && (candle == nil || c.Start < candle.Start) {
+				candle = c
+				n = i
+			}
+		}
+		if n < 0 {
+			break
+		}
+		iters[n].next()
+		e := NewEvent("candle", EventCandle, t.Name, candle, param.BinSize)
+		e.Symbol = t.tbls[n].GetSymbol()
+		t.Bus.WaitEmpty()
+		t.Bus.Send(e)
+	}
+	if t.closeCh != nil {
+		log.Info("kline tables emitCandles finished")
+		t.closeCh <- true
+	}
+}
@@ -87,7 +87,7 @@ func (t *TimeTbl) getDatasWithParam(since, end time.Time, limit, offset int) (da
 	ret := t.creator.Slice()
 	sess := t.getTable()
 	defer sess.Close()
-	err = sess.Asc("start").Where("start>=? and start<?", since.Unix(), end.Unix()).Limit(limit, offset).Find(ret)
+	err = sess.Asc("start", "id").Where("start>=? and start<?", since.Unix(), end.Unix()).Limit(limit, offset).Find(ret)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,209 @@
+package dbstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// TickTbl market trade tick table
+type TickTbl struct {
+	BaseProcesser
+	TimeTbl
+	loadData bool
+
+	cache      []interface{}
+	cacheMutex sync.Mutex
+}
+
+func NewTickTbl(db *DBStore, exchange, symbol string) (t *TickTbl) {
+	t = new(TickTbl)
+	tbl := NewTimeTbl(db, t, exchange, symbol, "tick", "")
+	t.TimeTbl = *tbl
+	t.BaseProcesser.Name = "ticktbl:" + t.table
+	return
+}
+
+func (tbl *TickTbl) Sing() TimeData {
+	return new(TradeTick)
+}
+
+func (tbl *TickTbl) Slice() interface{} {
+	return &[]*TradeTick{}
+}
+
+func (tbl *TickTbl) GetSlice(data interface{}) (rets []interface{}) {
+	datas, ok := data.(*[]*TradeTick)
+	if !ok {
+		log.Error("TickTbl getslice error")
+		return
+	}
+	rets = make([]interface{}, len(*datas))
+	for k, v := range *datas {
+		rets[k] = v
+	}
+	return
+}
+
+// SetLoadDataMode emit ticks from table if true, otherwise record market trades to table
+func (tbl *TickTbl) SetLoadDataMode(bLoad bool) {
+	tbl.loadData = bLoad
+}
+
+func (tbl *TickTbl) Init(bus *Bus) (err error) {
+	tbl.BaseProcesser.Init(bus)
+	if !tbl.loadData {
+		tbl.Subscribe(EventTradeMarket, tbl.onEventTradeMarket)
+	}
+	tbl.Subscribe(EventWatch, tbl.onEventWatch)
+	return
+}
+
+func (tbl *TickTbl) Stop() (err error) {
+	err = tbl.flush()
+	return
+}
+
+// WriteData write one tick
+func (tbl *TickTbl) WriteData(data interface{}) (err error) {
+	return tbl.WriteDatas([]interface{}{data})
+}
+
+// WriteDatas write ticks, many ticks share the same start so duplicated ticks are just ignored
+func (tbl *TickTbl) WriteDatas(datas []interface{}) (err error) {
+	return writeIgnoreDuplicate(&tbl.TimeTbl, datas)
+}
+
+func (tbl *TickTbl) flush() (err error) {
+	tbl.cacheMutex.Lock()
+	cache := tbl.cache
+	tbl.cache = nil
+	tbl.cacheMutex.Unlock()
+	if len(cache) == 0 {
+		return
+	}
+	err = tbl.WriteDatas(cache)
+	return
+}
+
+func (tbl *TickTbl) onEventTradeMarket(e *Event) (err error) {
+	trade, ok := e.GetData().(*Trade)
+	if !ok {
+		err = fmt.Errorf("TickTbl trade type error: %#v", e.GetData())
+		return
+	}
+	tbl.cacheMutex.Lock()
+	tbl.cache = append(tbl.cache, NewTradeTick(trade))
+	n := len(tbl.cache)
+	tbl.cacheMutex.Unlock()
+	if n >= 256 {
+		err = tbl.flush()
+	}
+	return
+}
+
+func (tbl *TickTbl) onEventWatch(e *Event) (err error) {
+	wParam, ok := e.GetData().(*WatchParam)
+	if !ok {
+		err = fmt.Errorf("event not watch %s %#v", e.Name, e.Data)
+		return
+	}
+	if wParam.Type != EventTradeMarket || !tbl.loadData {
+		return
+	}
+	param, _ := wParam.Data.(*CandleParam)
+	if param == nil {
+		err = fmt.Errorf("event not CandleParam %s %#v", e.Name, e.Data)
+		return
+	}
+	go tbl.emitTrades(*param)
+	return
+}
+
+// emitTrades emit market trades in table, 1m candles are synthesized from trades
+func (tbl *TickTbl) emitTrades(param CandleParam) {
+	ticks, err := tbl.DataChan(param.Start, param.End, "tick")
+	if err != nil {
+		log.Error("TickTbl get ticks failed:", err.Error())
+		return
+	}
+	var builder candleBuilder
+	for v := range ticks {
+		for _, t := range v {
+			tick := t.(*TradeTick)
+			builder.emit(&tbl.BaseProcesser, param.Symbol, tick)
+		}
+	}
+	builder.flush(&tbl.BaseProcesser)
+	if tbl.closeCh != nil {
+		log.Info("tick table emitTrades finished")
+		tbl.closeCh <- true
+	}
+}
+
+// candleBuilder synthesize 1m candles from ticks
+type candleBuilder struct {
+	candle *Candle
+}
+
+// emit send the tick as market trade, the candle is sent before the first tick of next minute
+func (b *candleBuilder) emit(proc *BaseProcesser, symbol string, tick *TradeTick) {
+	start := tick.Start - tick.Start%60
+	if b.candle != nil && b.candle.Start != start {
+		b.flush(proc)
+	}
+	candle := b.candle
+	if candle == nil {
+		candle = &Candle{Start: start, Open: tick.Price, High: tick.Price, Low: tick.Price}
+		b.candle = candle
+	}
+	if tick.Price > candle.High {
+		candle.High = tick.Price
+	}
+	if tick.Price < candle.Low {
+		candle.Low = tick.Price
+	}
+	candle.Close = tick.Price
+	candle.Volume += tick.Amount
+	candle.Turnover += tick.Price * tick.Amount
+	candle.Trades++
+	proc.Bus.WaitEmpty()
+	proc.Send(symbol, EventTradeMarket, tick.Trade())
+}
+
+// flush send the building candle
+func (b *candleBuilder) flush(proc *BaseProcesser) {
+	if b.candle == nil {
+		return
+	}
+	proc.Bus.WaitEmpty()
+	proc.SendWithExtra("candle", EventCandle, b.candle, "1m")
+	b.candle = nil
+}
+
+// writeIgnoreDuplicate write datas to table, duplicated datas are ignored
+func writeIgnoreDuplicate(tbl *TimeTbl, datas []interface{}) (err error) {
+	sess := tbl.getTable()
+	defer sess.Close()
+	err = sess.Begin()
+	if err != nil {
+		return
+	}
+	for _, data := range datas {
+		v := data.(TimeData)
+		v.SetTable(tbl.table)
+		_, err = sess.Insert(data)
+		if err != nil && !strings.Contains(err.Error(), "Duplicate entry") && !strings.Contains(err.Error(), "UNIQUE constraint") {
+			log.Errorf("%s insert %s error:%#v", tbl.table, v, err)
+		}
+		err = nil
+	}
+	err = sess.Commit()
+	return
+}
@@ -1,18 +1,129 @@
 package dbstore
 
-// type Trade struct {
-// 	ID     string
-// 	Action TradeType
-// 	Time   time.Time
-// 	Price  float64
-// 	Amount float64
-// 	Side   string
-// 	Remark string
-// }
+import (
+	"fmt"
+	"time"
 
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// TradeTbl journal of live trading, records order actions, order status updates and trades
 type TradeTbl struct {
+	BaseProcesser
+	TimeTbl
+}
+
+func NewTradeTbl(db *DBStore, exchange, symbol string) (t *TradeTbl) {
+	t = new(TradeTbl)
+	tbl := NewTimeTbl(db, t, exchange, symbol, "trade", "")
+	t.TimeTbl = *tbl
+	t.BaseProcesser.Name = "tradetbl:" + t.table
+	t.BaseProcesser.Symbol = symbol
+	return
+}
+
+func (tbl *TradeTbl) Sing() TimeData {
+	return new(TradeRecord)
+}
+
+func (tbl *TradeTbl) Slice() interface{} {
+	return &[]*TradeRecord{}
+}
+
+func (tbl *TradeTbl) GetSlice(data interface{}) (rets []interface{}) {
+	datas, ok := data.(*[]*TradeRecord)
+	if !ok {
+		log.Error("TradeTbl getslice error")
+		return
+	}
+	rets = make([]interface{}, len(*datas))
+	for k, v := range *datas {
+		rets[k] = v
+	}
+	return
+}
+
+// Init subscribe orders, order status and trades, TradeTbl should be added before risk to record the rejected orders
+func (tbl *TradeTbl) Init(bus *Bus) (err error) {
+	tbl.BaseProcesser.Init(bus)
+	tbl.Subscribe(EventOrder, tbl.onEventOrder)
+	tbl.Subscribe(EventOrderStatus, tbl.onEventOrderStatus)
+	tbl.Subscribe(EventTrade, tbl.onEventTrade)
+	return
+}
+
+// WriteData write one record, records are written at once so they survive crashes
+func (tbl *TradeTbl) WriteData(data interface{}) (err error) {
+	return writeIgnoreDuplicate(&tbl.TimeTbl, []interface{}{data})
+}
+
+func (tbl *TradeTbl) onEventOrder(e *Event) (err error) {
+	if !tbl.MatchSymbol(e) {
+		return
+	}
+	act, ok := e.GetData().(*TradeAction)
+	if !ok {
+		err = fmt.Errorf("TradeTbl order type error: %#v", e.GetData())
+		return
+	}
+	err = tbl.WriteData(NewActionRecord(act, tbl.Now()))
+	return
+}
+
+func (tbl *TradeTbl) onEventOrderStatus(e *Event) (err error) {
+	if !tbl.MatchSymbol(e) {
+		return
+	}
+	update, ok := e.GetData().(*OrderUpdate)
+	if !ok {
+		err = fmt.Errorf("TradeTbl order status type error: %#v", e.GetData())
+		return
+	}
+	err = tbl.WriteData(NewOrderRecord(update))
+	return
+}
+
+func (tbl *TradeTbl) onEventTrade(e *Event) (err error) {
+	if !tbl.MatchSymbol(e) {
+		return
+	}
+	tr, ok := e.GetData().(*Trade)
+	if !ok {
+		err = fmt.Errorf("TradeTbl trade type error: %#v", e.GetData())
+		return
+	}
+	err = tbl.WriteData(NewTradeRecord(tr))
+	return
+}
+
+// GetRecords get all records between start and end
+func (tbl *TradeTbl) GetRecords(start, end time.Time) (records []*TradeRecord, err error) {
+	datas, err := tbl.DataChan(start, end, "trade")
+	if err != nil {
+		return
+	}
+	for v := range datas {
+		for _, r := range v {
+			records = append(records, r.(*TradeRecord))
+		}
+	}
+	return
 }
 
-func NewTradeTbl(db *DBStore, id int64) (t *TradeTbl) {
+// GetTrades get the trades between start and end, which can be analyzed by report
+func (tbl *TradeTbl) GetTrades(start, end time.Time) (trades []Trade, err error) {
+	records, err := tbl.GetRecords(start, end)
+	if err != nil {
+		return
+	}
+	for _, v := range records {
+		if v.Kind == RecordTrade {
+			trades = append(trades, v.Trade())
+		}
+	}
 	return
 }
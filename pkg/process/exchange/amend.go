@@ -0,0 +1,137 @@
+package exchange
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// amendOrder amend working order natively if the exchange supports, otherwise cancel and place it again,
+// the result is sent by EventOrderAmend
+func (b *TradeExchange) amendOrder(act TradeAction) {
+	amend := OrderAmend{Action: act}
+	amend.Reason = b.doAmendOrder(act)
+	if amend.Reason != "" {
+		log.Warnf("TradeExchange amend order %s failed: %s", act.ID, amend.Reason)
+	}
+	b.Send(act.ID, EventOrderAmend, &amend)
+}
+
+// resizeOrder resize working leg of group to act.Amount, which is the amount not filled
+func (b *TradeExchange) resizeOrder(act TradeAction) {
+	var filled float64
+	b.orderMutex.Lock()
+	if oi, ok := b.localOrderIndex[act.ID]; ok {
+		filled = oi.prevFilled + oi.Order.Filled
+	}
+	b.orderMutex.Unlock()
+	reason := b.doAmendOrder(TradeAction{ID: act.ID, Action: AmendOne, Amount: filled + act.Amount, Price: act.Price, Time: act.Time, Symbol: act.Symbol})
+	if reason != "" {
+		log.Warnf("TradeExchange resize order %s failed: %s", act.ID, reason)
+	}
+}
+
+func (b *TradeExchange) doAmendOrder(act TradeAction) (reason string) {
+	if value, ok := b.stopOrders.Load(act.ID); ok {
+		stop := *value.(*localStop)
+		if act.Price != 0 && stop.opt.IsTrailing() {
+			return "price of trailing stop can't be amended"
+		}
+		if act.Price != 0 {
+			stop.Price = act.Price
+		}
+		if act.Amount != 0 {
+			stop.Amount = act.Amount
+		}
+		b.stopOrders.Store(act.ID, &stop)
+		return
+	}
+	// the order is updated by recvDatas, it's read and replaced under orderMutex
+	b.orderMutex.Lock()
+	oi, ok := b.localOrderIndex[act.ID]
+	if !ok || oi.Filled {
+		b.orderMutex.Unlock()
+		return "order not found"
+	}
+	old, prevFilled, state := oi.Order, oi.prevFilled, oi.state
+	b.orderMutex.Unlock()
+	filled := prevFilled + old.Filled
+	total := prevFilled + old.Amount
+	if act.Amount != 0 {
+		if act.Amount <= filled {
+			return fmt.Sprintf("amount %f not more than filled %f", act.Amount, filled)
+		}
+		total = act.Amount
+	}
+	price := old.Price
+	if act.Price != 0 {
+		price = act.Price
+	}
+	if amendEx, ok := b.impl.(OrderAmendExchange); ok {
+		ret, err := doOrderWithRetry(10, func() (interface{}, error) {
+			return amendEx.AmendOrder(&old, price, total-prevFilled)
+		})
+		if err != nil {
+			return err.Error()
+		}
+		od := ret.(*Order)
+		b.orderMutex.Lock()
+		delete(b.orders, old.OrderID)
+		oi.Order = *od
+		b.orders[od.OrderID] = oi
+		b.orderMutex.Unlock()
+		return
+	}
+	// the canceled status of the replaced order is not reported
+	b.setReplaced(oi, true)
+	ret, err := doOrderWithRetry(10, func() (interface{}, error) {
+		return b.impl.CancelOrder(&old)
+	})
+	if err != nil {
+		b.setReplaced(oi, false)
+		return "cancel failed: " + err.Error()
+	}
+	// the order may be filled before it is canceled, the replacement is sized by the final filled amount
+	b.orderMutex.Lock()
+	if oi.Order.Filled > old.Filled {
+		filled = prevFilled + oi.Order.Filled
+	}
+	b.orderMutex.Unlock()
+	if od, ok := ret.(*Order); ok && od != nil && prevFilled+od.Filled > filled {
+		filled = prevFilled + od.Filled
+	}
+	if total-filled <= 0 {
+		b.setReplaced(oi, false)
+		return fmt.Sprintf("order filled %f before replaced", filled)
+	}
+	newAct := TradeAction{ID: act.ID, Action: oi.Action, Amount: total - filled, Price: price, Time: act.Time, Symbol: b.symbol}
+	ret, err = doOrderWithRetry(10, func() (interface{}, error) {
+		return b.processOrder(newAct, nil)
+	})
+	if err != nil {
+		b.orderMutex.Lock()
+		if b.localOrderIndex[act.ID] == oi {
+			delete(b.localOrderIndex, act.ID)
+		}
+		canceled := oi.action()
+		b.orderMutex.Unlock()
+		b.orderUpdate(canceled, OrderCanceled, filled, "replace failed")
+		return "order canceled but replace failed: " + err.Error()
+	}
+	od := ret.(*Order)
+	n := &OrderInfo{Order: *od, Action: oi.Action, LocalID: act.ID, prevFilled: filled, state: state}
+	b.orderMutex.Lock()
+	b.orders[od.OrderID] = n
+	b.localOrderIndex[act.ID] = n
+	b.orderMutex.Unlock()
+	return
+}
+
+// setReplaced mark the order replaced before it's canceled, so its canceled status is not reported
+func (b *TradeExchange) setReplaced(oi *OrderInfo, replaced bool) {
+	b.orderMutex.Lock()
+	oi.replaced = replaced
+	b.orderMutex.Unlock()
+}
@@ -0,0 +1,334 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gobinance "github.com/adshao/go-binance/v2"
+	bfutures "github.com/adshao/go-binance/v2/futures"
+	log "github.com/sirupsen/logrus"
+	"github.com/ztrade/exchange"
+	bcommon "github.com/ztrade/exchange/binance/common"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+var newLock sync.Mutex
+
+var (
+	_ OrderOptionExchange  = &Futures{}
+	_ HedgeExchange        = &Futures{}
+	_ ReconcileExchange    = &Futures{}
+	_ TrailingStopExchange = &Futures{}
+	_ FundingRateFetcher   = &Futures{}
+)
+
+// callback rate of binance trailing stop in percent
+const (
+	minCallbackRate = 0.1
+	maxCallbackRate = 10
+)
+
+// Futures binance futures exchange with the features github.com/ztrade/exchange doesn't provide:
+// order options, orders with position side in hedge mode, open orders and positions for reconcile
+type Futures struct {
+	exchange.Exchange
+	api     *bfutures.Client
+	timeout time.Duration
+	symbols map[string]Symbol
+}
+
+// Extend wrap the binance futures exchange, other exchanges are returned as they are
+func Extend(ex exchange.Exchange, cfg exchange.Config, cltName string) (ret exchange.Exchange, err error) {
+	ret = ex
+	if ex.Info().Name != "binance_futures" {
+		return
+	}
+	var eCfg bcommon.BinanceConfig
+	err = cfg.UnmarshalKey(fmt.Sprintf("exchanges.%s", cltName), &eCfg)
+	if err != nil {
+		return
+	}
+	f := &Futures{Exchange: ex, timeout: eCfg.Timeout, symbols: make(map[string]Symbol)}
+	if f.timeout == 0 {
+		f.timeout = time.Second * 5
+	}
+	newLock.Lock()
+	bfutures.UseTestnet = eCfg.IsTest
+	f.api = gobinance.NewFuturesClient(eCfg.Key, eCfg.Secret)
+	bfutures.UseTestnet = false
+	newLock.Unlock()
+	if clientProxy := cfg.GetString("proxy"); clientProxy != "" {
+		var proxyURL *url.URL
+		proxyURL, err = url.Parse(clientProxy)
+		if err != nil {
+			return
+		}
+		f.api.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	}
+	symbols, err := ex.Symbols()
+	if err != nil {
+		return
+	}
+	for _, v := range symbols {
+		f.symbols[v.Symbol] = v
+	}
+	ret = f
+	return
+}
+
+// ProcessOrderWithOption send order with time in force, GTD and percent trailing stop
+func (f *Futures) ProcessOrderWithOption(act TradeAction, opt OrderOption) (ret *Order, err error) {
+	return f.createOrder(act, opt, false)
+}
+
+// ProcessHedgeOrder send order with position side of its leg, the account must be in hedge mode
+func (f *Futures) ProcessHedgeOrder(act TradeAction, opt OrderOption) (ret *Order, err error) {
+	return f.createOrder(act, opt, true)
+}
+
+func (f *Futures) createOrder(act TradeAction, opt OrderOption, hedge bool) (ret *Order, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	side := bfutures.SideTypeSell
+	if act.Action.IsLong() {
+		side = bfutures.SideTypeBuy
+	}
+	if symbol, ok := f.symbols[act.Symbol]; ok {
+		act.Price = symbol.FixPrice(act.Price)
+	}
+	sent := f.api.NewCreateOrderService().Symbol(act.Symbol).Side(side).Quantity(fmt.Sprintf("%f", act.Amount))
+	var opts []bfutures.RequestOption
+	switch {
+	case opt.IsTrailing():
+		if !f.IsNativeTrailing(opt) {
+			err = fmt.Errorf("binance unsupport trailing stop, distance: %f, percent: %f", opt.TrailDistance, opt.TrailPercent)
+			return
+		}
+		sent = sent.Type(bfutures.OrderTypeTrailingStopMarket).CallbackRate(fmt.Sprintf("%f", opt.TrailPercent))
+		if act.Price > 0 {
+			sent = sent.ActivationPrice(fmt.Sprintf("%f", act.Price))
+		}
+	case act.Action.IsStop():
+		sent = sent.Type(bfutures.OrderTypeStopMarket).StopPrice(fmt.Sprintf("%f", act.Price))
+	case act.Action&Market == Market:
+		sent = sent.Type(bfutures.OrderTypeMarket)
+	default:
+		var tif bfutures.TimeInForceType
+		tif, err = timeInForce(opt.TimeInForce)
+		if err != nil {
+			return
+		}
+		sent = sent.Type(bfutures.OrderTypeLimit).Price(fmt.Sprintf("%f", act.Price)).TimeInForce(tif)
+		if opt.TimeInForce == GTD {
+			opts = append(opts, bfutures.WithExtraForm(map[string]any{"goodTillDate": opt.ExpireTime.UnixMilli()}))
+		}
+	}
+	if hedge {
+		positionSide := bfutures.PositionSideTypeShort
+		if IsLongLeg(act.Action) {
+			positionSide = bfutures.PositionSideTypeLong
+		}
+		sent = sent.PositionSide(positionSide)
+	} else if !act.Action.IsOpen() {
+		sent = sent.ReduceOnly(true)
+	}
+	resp, err := sent.Do(ctx, opts...)
+	if err != nil {
+		return
+	}
+	ret = &Order{
+		OrderID:  strconv.FormatInt(resp.OrderID, 10),
+		Symbol:   resp.Symbol,
+		Currency: resp.Symbol,
+		Amount:   parseFloat(resp.OrigQuantity),
+		Price:    parseFloat(resp.Price),
+		Status:   strings.ToUpper(string(resp.Status)),
+		Side:     strings.ToLower(string(resp.Side)),
+		Time:     time.UnixMilli(resp.UpdateTime),
+	}
+	return
+}
+
+// IsNativeTrailing binance trailing stop follows the best price by callback rate in percent,
+// trailing stop by distance is emulated locally
+func (f *Futures) IsNativeTrailing(opt OrderOption) bool {
+	return opt.TrailPercent >= minCallbackRate && opt.TrailPercent <= maxCallbackRate
+}
+
+// timeInForce convert time in force to binance, PostOnly is GTX
+func timeInForce(tif TimeInForce) (ret bfutures.TimeInForceType, err error) {
+	switch tif {
+	case "", GTC:
+		ret = bfutures.TimeInForceTypeGTC
+	case IOC:
+		ret = bfutures.TimeInForceTypeIOC
+	case FOK:
+		ret = bfutures.TimeInForceTypeFOK
+	case PostOnly:
+		ret = bfutures.TimeInForceTypeGTX
+	case GTD:
+		ret = bfutures.TimeInForceType("GTD")
+	default:
+		err = fmt.Errorf("binance unsupport time in force %s", tif)
+	}
+	return
+}
+
+// GetOpenOrders get the open orders of symbol, the action is told by position side or reduce only flag
+func (f *Futures) GetOpenOrders(symbol string) (orders []*OpenOrder, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	resp, err := f.api.NewListOpenOrdersService().Symbol(symbol).Do(ctx)
+	if err != nil {
+		return
+	}
+	for _, v := range resp {
+		o := &OpenOrder{Order: Order{
+			OrderID:  strconv.FormatInt(v.OrderID, 10),
+			Symbol:   v.Symbol,
+			Currency: v.Symbol,
+			Amount:   parseFloat(v.OrigQuantity),
+			Price:    parseFloat(v.Price),
+			Filled:   parseFloat(v.ExecutedQuantity),
+			Status:   strings.ToUpper(string(v.Status)),
+			Side:     strings.ToLower(string(v.Side)),
+			Time:     time.UnixMilli(v.Time),
+		}, Action: orderAction(v)}
+		if o.Action.IsStop() {
+			o.Price = parseFloat(v.StopPrice)
+		}
+		orders = append(orders, o)
+	}
+	return
+}
+
+// orderAction return the action of binance order
+func orderAction(o *bfutures.Order) TradeType {
+	buy := o.Side == bfutures.SideTypeBuy
+	switch o.Type {
+	case bfutures.OrderTypeStopMarket, bfutures.OrderTypeTrailingStopMarket:
+		if buy {
+			return StopShort
+		}
+		return StopLong
+	}
+	var act TradeType
+	switch {
+	case o.PositionSide == bfutures.PositionSideTypeLong:
+		act = CloseLong
+		if buy {
+			act = OpenLong
+		}
+	case o.PositionSide == bfutures.PositionSideTypeShort:
+		act = OpenShort
+		if buy {
+			act = CloseShort
+		}
+	case o.ReduceOnly || o.ClosePosition:
+		act = CloseLong
+		if buy {
+			act = CloseShort
+		}
+	default:
+		act = OpenShort
+		if buy {
+			act = OpenLong
+		}
+	}
+	if o.Type == bfutures.OrderTypeMarket {
+		act |= Market
+	}
+	return act
+}
+
+// GetPositions get the positions of symbol, there are long and short positions in hedge mode
+func (f *Futures) GetPositions(symbol string) (positions []*Position, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+	resp, err := f.api.NewGetPositionRiskService().Symbol(symbol).Do(ctx)
+	if err != nil {
+		return
+	}
+	for _, v := range resp {
+		pos := &Position{Symbol: v.Symbol, Hold: parseFloat(v.PositionAmt), Price: parseFloat(v.EntryPrice)}
+		switch bfutures.PositionSideType(v.PositionSide) {
+		case bfutures.PositionSideTypeLong:
+			pos.Type = Long
+		case bfutures.PositionSideTypeShort:
+			pos.Type = Short
+		default:
+			if pos.Hold > 0 {
+				pos.Type = Long
+			} else if pos.Hold < 0 {
+				pos.Type = Short
+			}
+		}
+		positions = append(positions, pos)
+	}
+	return
+}
+
+// Watch subscribe the stream, the position stream of github.com/ztrade/exchange drops the position side
+// and reuses the position, so it is copied and the closed position is fetched again to tell its side
+func (f *Futures) Watch(param exchange.WatchParam, fn exchange.WatchFn) error {
+	if param.Type != exchange.WatchTypePosition {
+		return f.Exchange.Watch(param, fn)
+	}
+	return f.Exchange.Watch(param, func(data interface{}) {
+		pos, ok := data.(*Position)
+		if !ok {
+			fn(data)
+			return
+		}
+		if pos.Hold != 0 {
+			p := *pos
+			fn(&p)
+			return
+		}
+		positions, err := f.GetPositions(pos.Symbol)
+		if err != nil {
+			log.Errorf("binance get positions of %s failed: %s", pos.Symbol, err.Error())
+			return
+		}
+		for _, v := range positions {
+			fn(v)
+		}
+	})
+}
+
+// GetFundingRates get history funding rates of symbol, binance returns 1000 rates at most once
+func (f *Futures) GetFundingRates(symbol string, start, end time.Time) (rates []*FundingRate, err error) {
+	limit := 1000
+	startTime := start.UnixMilli()
+	for {
+		var resp []*bfutures.FundingRate
+		ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+		resp, err = f.api.NewFundingRateService().Symbol(symbol).StartTime(startTime).EndTime(end.UnixMilli()).Limit(limit).Do(ctx)
+		cancel()
+		if err != nil {
+			return
+		}
+		for _, v := range resp {
+			rates = append(rates, &FundingRate{Start: v.FundingTime / 1000, Rate: parseFloat(v.FundingRate), MarkPrice: parseFloat(v.MarkPrice)})
+		}
+		if len(resp) < limit {
+			return
+		}
+		startTime = resp[len(resp)-1].FundingTime + 1
+	}
+}
+
+func parseFloat(str string) float64 {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,59 @@
+package binance
+
+import (
+	"testing"
+
+	bfutures "github.com/adshao/go-binance/v2/futures"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+func TestTimeInForce(t *testing.T) {
+	cases := map[TimeInForce]bfutures.TimeInForceType{
+		"":       bfutures.TimeInForceTypeGTC,
+		GTC:      bfutures.TimeInForceTypeGTC,
+		IOC:      bfutures.TimeInForceTypeIOC,
+		FOK:      bfutures.TimeInForceTypeFOK,
+		PostOnly: bfutures.TimeInForceTypeGTX,
+		GTD:      "GTD",
+	}
+	for k, v := range cases {
+		ret, err := timeInForce(k)
+		if err != nil || ret != v {
+			t.Fatalf("time in force %s should be %s: %s %v", k, v, ret, err)
+		}
+	}
+	if _, err := timeInForce("unknown"); err == nil {
+		t.Fatal("unknown time in force should fail")
+	}
+}
+
+func TestOrderAction(t *testing.T) {
+	cases := []struct {
+		order  bfutures.Order
+		action TradeType
+	}{
+		{bfutures.Order{Side: bfutures.SideTypeBuy, Type: bfutures.OrderTypeLimit, PositionSide: bfutures.PositionSideTypeBoth}, OpenLong},
+		{bfutures.Order{Side: bfutures.SideTypeSell, Type: bfutures.OrderTypeLimit, PositionSide: bfutures.PositionSideTypeBoth, ReduceOnly: true}, CloseLong},
+		{bfutures.Order{Side: bfutures.SideTypeBuy, Type: bfutures.OrderTypeMarket, PositionSide: bfutures.PositionSideTypeBoth, ReduceOnly: true}, CloseShort | Market},
+		{bfutures.Order{Side: bfutures.SideTypeSell, Type: bfutures.OrderTypeLimit, PositionSide: bfutures.PositionSideTypeShort}, OpenShort},
+		{bfutures.Order{Side: bfutures.SideTypeSell, Type: bfutures.OrderTypeLimit, PositionSide: bfutures.PositionSideTypeLong}, CloseLong},
+		{bfutures.Order{Side: bfutures.SideTypeSell, Type: bfutures.OrderTypeStopMarket, PositionSide: bfutures.PositionSideTypeBoth, ReduceOnly: true}, StopLong},
+		{bfutures.Order{Side: bfutures.SideTypeBuy, Type: bfutures.OrderTypeTrailingStopMarket, PositionSide: bfutures.PositionSideTypeShort}, StopShort},
+	}
+	for _, v := range cases {
+		if ret := orderAction(&v.order); ret != v.action {
+			t.Fatalf("action of %#v should be %s: %s", v.order, v.action, ret)
+		}
+	}
+}
+
+func TestIsNativeTrailing(t *testing.T) {
+	var f Futures
+	if !f.IsNativeTrailing(OrderOption{TrailPercent: 1}) {
+		t.Fatal("trailing stop by percent should be native")
+	}
+	if f.IsNativeTrailing(OrderOption{TrailDistance: 10}) || f.IsNativeTrailing(OrderOption{TrailPercent: 20}) {
+		t.Fatal("trailing stop by distance or out of callback rate should be emulated")
+	}
+}
@@ -7,6 +7,14 @@ import (
 
 var (
 	ErrCanRetry = errors.New("error but can retry")
+	// ErrStaleStream no data received from stream for longer than stale timeout
+	ErrStaleStream = errors.New("stale stream")
+	// ErrUnsupportOption order option not supported by exchange
+	ErrUnsupportOption = errors.New("unsupport order option")
+	// ErrUnsupportReconcile reconcile is configured but exchange can't fetch open orders and positions
+	ErrUnsupportReconcile = errors.New("unsupport reconcile")
+	// ErrUnsupportHedge hedge mode is configured but exchange can't send orders with position side
+	ErrUnsupportHedge = errors.New("unsupport hedge mode")
 )
 
 type dofn func() (interface{}, error)
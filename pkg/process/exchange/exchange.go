@@ -2,6 +2,8 @@ package exchange
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,6 +21,70 @@ type OrderInfo struct {
 	Order
 	Action TradeType
 	Filled bool
+	// filled cumulative filled amount of exchange order sent as trades
+	filled float64
+	// cost value of filled amount
+	cost float64
+	// grouped cumulative filled amount of exchange order counted by order groups
+	grouped float64
+	// prevFilled filled amount of the orders replaced by this order
+	prevFilled float64
+	// replaced order is canceled and replaced by a new order when amended
+	replaced bool
+	// state last state sent to strategy
+	state OrderState
+}
+
+// action return the local order
+func (o *OrderInfo) action() TradeAction {
+	return TradeAction{ID: o.LocalID, Action: o.Action, Amount: o.prevFilled + o.Amount, Price: o.Price, Time: o.Time, Symbol: o.Symbol}
+}
+
+// fill record the cumulative filled amount and return the trade of the newly filled part,
+// price of filled order is its average price, the price of the last part is calculated from the cost of previous fills,
+// otherwise price is the price of the newly filled part, no trade is returned if price is unknown,
+// the trade is stamped with the time of fill
+func (o *OrderInfo) fill(price, filled float64, average bool, tm time.Time) (tr Trade, ok bool) {
+	amount := filled - o.filled
+	if amount <= 0 || price <= 0 {
+		return
+	}
+	if average {
+		if last := (price*filled - o.cost) / amount; last > 0 {
+			price = last
+		}
+	}
+	o.filled = filled
+	o.cost += price * amount
+	return Trade{ID: o.LocalID, Action: o.Action, Time: tm, Price: price, Amount: amount, Side: o.Side, Remark: o.OrderID}, true
+}
+
+// orderState convert status of exchange order to order state, empty if unknown
+func orderState(status string, filled float64) OrderState {
+	switch strings.ToUpper(status) {
+	case OrderStatusFilled:
+		return OrderFilled
+	case OrderStatusCanceled, "CANCELLED":
+		return OrderCanceled
+	case "EXPIRED":
+		return OrderExpired
+	case "REJECTED":
+		return OrderRejected
+	case "NEW", "PARTIALLY_FILLED":
+		if filled > 0 {
+			return OrderPartiallyFilled
+		}
+		return OrderNew
+	}
+	return ""
+}
+
+// localStop stop order emulated by TradeExchange with market trades
+type localStop struct {
+	TradeAction
+	opt OrderOption
+	// best price since trailing stop placed
+	best float64
 }
 
 type TradeExchange struct {
@@ -31,18 +97,41 @@ type TradeExchange struct {
 
 	orders          map[string]*OrderInfo
 	localOrderIndex map[string]*OrderInfo
+	// orderMutex guards orders, localOrderIndex and the OrderInfo in them,
+	// which are updated by recvDatas and orderRoutine
+	orderMutex sync.Mutex
 
 	closeCh chan bool
 
 	pos            Position
 	positionUpdate int64
-	exchangeName   string
-	symbol         string
+	// hedge exchange holds long and short positions independently
+	hedge    bool
+	hedgePos HedgePosition
+	// reconcile policy of open orders and positions found on start, empty means adopt if exchange supports
+	reconcile    ReconcilePolicy
+	exchangeName string
+	symbol       string
 
 	candleParam CandleParam
+	// lastCandle start of last candle sent
+	lastCandle int64
+
+	streams       map[string]*stream
+	staleTimeouts map[string]time.Duration
+	streamMutex   sync.Mutex
 
 	localStopOrder bool
-	stopOrders     sync.Map
+	// paper only provides market data, orders are filled by virtual exchange
+	paper bool
+	// stopOrders local stop orders by id, the values are *localStop
+	stopOrders sync.Map
+	// orderOptions options of orders by local id
+	orderOptions sync.Map
+
+	groups     map[string]*OrderGroup
+	groupLegs  map[string]*groupLeg
+	groupMutex sync.Mutex
 }
 
 func NewTradeExchange(exName string, impl exchange.Exchange, symbol string) *TradeExchange {
@@ -56,6 +145,10 @@ func NewTradeExchange(exName string, impl exchange.Exchange, symbol string) *Tra
 	te.closeCh = make(chan bool)
 	te.symbol = symbol
 	te.datas = make(chan interface{}, 1024)
+	te.groups = make(map[string]*OrderGroup)
+	te.groupLegs = make(map[string]*groupLeg)
+	te.streams = make(map[string]*stream)
+	te.staleTimeouts = make(map[string]time.Duration)
 	return te
 }
 
@@ -66,47 +159,73 @@ func (b *TradeExchange) UseLocalStopOrder(enable bool) {
 	}
 }
 
+// UsePaperMode only provide candles, market trades and depths of exchange, orders and account are not touched
+func (b *TradeExchange) UsePaperMode(enable bool) {
+	b.paper = enable
+	if enable {
+		log.Infof("%s TradeExchange use paper mode", b.exchangeName)
+	}
+}
+
 func (b *TradeExchange) Init(bus *Bus) (err error) {
 	b.BaseProcesser.Init(bus)
-	b.Subscribe(EventOrder, b.onEventOrder)
+	if !b.paper {
+		b.Subscribe(EventOrder, b.onEventOrder)
+	}
 	b.Subscribe(EventWatch, b.onEventWatch)
 	return
 }
 
 func (b *TradeExchange) Start() (err error) {
-	b.impl.Watch(exchange.WatchParam{Type: exchange.WatchTypeBalance}, func(data interface{}) {
+	if b.paper {
+		err = b.impl.Start()
+		if err != nil {
+			return err
+		}
+		go b.recvDatas()
+		go b.watchdog()
+		return
+	}
+	if _, ok := b.impl.(HedgeExchange); b.hedge && !ok {
+		return fmt.Errorf("%w: %s can't send orders with position side", ErrUnsupportHedge, b.exchangeName)
+	}
+	b.watch(exchange.WatchParam{Type: exchange.WatchTypeBalance}, func(data interface{}) {
 		b.datas <- data
 	})
-	b.impl.Watch(exchange.WatchParam{Type: exchange.WatchTypePosition}, func(data interface{}) {
+	b.watch(exchange.WatchParam{Type: exchange.WatchTypePosition}, func(data interface{}) {
 		b.datas <- data
 	})
-	b.impl.Watch(exchange.WatchParam{Type: exchange.WatchTypeTrade}, func(data interface{}) {
+	b.watch(exchange.WatchParam{Type: exchange.WatchTypeTrade}, func(data interface{}) {
 		b.datas <- data
 	})
 	err = b.impl.Start()
 	if err != nil {
 		return err
 	}
+	err = b.reconcileOnStart()
+	if err != nil {
+		return err
+	}
 	go b.recvDatas()
 	go b.orderRoutine()
+	go b.watchdog()
 	return
 }
 
 func (b *TradeExchange) Stop() (err error) {
 	err = b.impl.Stop()
+	close(b.closeCh)
 	close(b.actChan)
 	return
 }
 
 func (b *TradeExchange) recvDatas() {
-	var ok bool
 	var posTime int64
-	var o *OrderInfo
 	bFirst := true
 	var err error
 	var tFirstLastStart int64
-Out:
 	for data := range b.datas {
+		b.received(data)
 		switch value := data.(type) {
 		case *Candle:
 			if bFirst {
@@ -115,13 +234,16 @@ Out:
 				param.End = value.Time().Add(-1 * time.Second)
 				tFirstLastStart, err = b.emitRecentCandles(param)
 				if err != nil {
-					log.Errorf("TradeExchange recv data:", err.Error())
+					log.Errorf("TradeExchange recv data: %s", err.Error())
 					panic(err.Error())
 				}
-				if value.Start <= tFirstLastStart {
-					continue
-				}
+				atomic.StoreInt64(&b.lastCandle, tFirstLastStart)
+			}
+			// candles may be sent again by resubscription and backfill
+			if value.Start <= atomic.LoadInt64(&b.lastCandle) {
+				continue
 			}
+			atomic.StoreInt64(&b.lastCandle, value.Start)
 			b.SendWithExtra("candle", EventCandle, value, b.candleParam.BinSize)
 		case *Balance:
 			b.Send(b.exchangeName, EventBalance, value)
@@ -130,6 +252,10 @@ Out:
 				log.Infof("TradeExchange ignore event: %#v, exchange symbol: %s, data symbol: %s", value, b.symbol, value.Symbol)
 				continue
 			}
+			if b.hedge {
+				b.onHedgePosition(value)
+				continue
+			}
 			b.pos = *value
 			posTime = time.Now().Unix()
 			atomic.StoreInt64(&b.positionUpdate, posTime)
@@ -139,23 +265,7 @@ Out:
 				log.Infof("TradeExchange ignore event: %#v, exchange symbol: %s, data symbol: %s", value, b.symbol, value.Symbol)
 				continue
 			}
-			o, ok = b.orders[value.OrderID]
-			if !ok || o.Filled {
-				continue Out
-			}
-			o.Order = *value
-			if value.Status != OrderStatusFilled {
-				continue Out
-			}
-			o.Filled = true
-			tr := Trade{ID: o.LocalID,
-				Action: o.Action,
-				Time:   o.Time,
-				Price:  o.Price,
-				Amount: o.Amount,
-				Side:   o.Side,
-				Remark: o.OrderID}
-			b.Send(o.OrderID, EventTrade, &tr)
+			b.onOrder(value)
 		case *Depth:
 			b.Send(b.exchangeName, EventDepth, value)
 		case *Trade:
@@ -184,19 +294,37 @@ func (b *TradeExchange) onEventCandleParam(e *Event) (err error) {
 
 func (b *TradeExchange) onEventOrder(e *Event) (err error) {
 	act := e.GetData().(*TradeAction)
+	if opt, ok := e.GetExtra().(*OrderOption); ok && opt != nil {
+		if opt.IsGrouped() {
+			b.addGroupLeg(*act, *opt)
+			return
+		}
+		b.orderOptions.Store(act.ID, *opt)
+	}
+	if act.Action == trademodel.CancelAll {
+		b.clearGroups()
+	} else if act.Action == trademodel.CancelOne && !b.removeGroupLeg(act.ID) {
+		return
+	} else if act.Action == AmendOne && b.amendGroupLeg(*act) {
+		return
+	}
 	b.actChan <- *act
 	return
 }
 
 func (b *TradeExchange) onEventTradeMarket(trade *Trade) {
-	if !b.localStopOrder || b.pos.Hold == 0 {
+	if b.holdOf(true) <= 0 && b.holdOf(false) <= 0 {
 		return
 	}
 	var deleteOrders []string
 	b.stopOrders.Range(func(key, value any) bool {
 		id := key.(string)
-		act := value.(TradeAction)
-		if b.pos.Hold > 0 && act.Action == StopLong && trade.Price < act.Price {
+		stop := value.(*localStop)
+		if stop.opt.IsTrailing() {
+			stop.best, stop.Price = stop.opt.TrailStop(stop.Action == StopLong, stop.best, stop.Price, trade.Price)
+		}
+		act := stop.TradeAction
+		if b.holdOf(true) > 0 && act.Action == StopLong && trade.Price < act.Price {
 			// do stop long
 			newAct := TradeAction{
 				ID:     id + "_stop",
@@ -211,7 +339,7 @@ func (b *TradeExchange) onEventTradeMarket(trade *Trade) {
 			b.actChan <- newAct
 			return true
 		}
-		if b.pos.Hold < 0 && act.Action == StopShort && trade.Price > act.Price {
+		if b.holdOf(false) > 0 && act.Action == StopShort && trade.Price > act.Price {
 			// do stop short
 			newAct := TradeAction{
 				ID:     id + "_stop",
@@ -241,11 +369,11 @@ func (b *TradeExchange) onEventWatch(e *Event) (err error) {
 	param := e.GetData().(*WatchParam)
 	switch param.Type {
 	case EventTradeMarket:
-		b.impl.Watch(exchange.WatchParam{Type: exchange.WatchTypeTradeMarket, Param: map[string]string{"symbol": param.Extra.(string)}}, func(data interface{}) {
+		b.watch(exchange.WatchParam{Type: exchange.WatchTypeTradeMarket, Param: map[string]string{"symbol": param.Extra.(string)}}, func(data interface{}) {
 			b.datas <- data
 		})
 	case EventDepth:
-		b.impl.Watch(exchange.WatchParam{Type: exchange.WatchTypeDepth, Param: map[string]string{"symbol": param.Extra.(string)}}, func(data interface{}) {
+		b.watch(exchange.WatchParam{Type: exchange.WatchTypeDepth, Param: map[string]string{"symbol": param.Extra.(string)}}, func(data interface{}) {
 			b.datas <- data
 		})
 	default:
@@ -260,55 +388,196 @@ func (b *TradeExchange) orderRoutine() {
 	var ret interface{}
 	var exist bool
 	for v := range b.actChan {
-		// hook the stop order when localStopOrder enabled
-		if v.Action.IsStop() && b.localStopOrder {
-			b.stopOrders.Store(v.ID, v)
-			continue
-		} else if v.Action == trademodel.CancelAll {
+		if v.Action == trademodel.CancelAll {
 			b.cancelAllOrder()
+			b.stopOrders.Range(func(key, value any) bool {
+				b.orderUpdate(value.(*localStop).TradeAction, OrderCanceled, 0, "")
+				return true
+			})
 			b.stopOrders = sync.Map{}
 			continue
 		} else if v.Action == trademodel.CancelOne {
-			_, exist = b.stopOrders.LoadAndDelete(v.ID)
+			var stop any
+			stop, exist = b.stopOrders.LoadAndDelete(v.ID)
 			if exist {
+				b.orderUpdate(stop.(*localStop).TradeAction, OrderCanceled, 0, "")
 				continue
 			}
+			b.orderMutex.Lock()
 			oi, ok := b.localOrderIndex[v.ID]
+			var od Order
+			if ok {
+				od = oi.Order
+			}
+			b.orderMutex.Unlock()
 			if !ok {
 				log.Errorf("local order: %s not found", v.ID)
 				continue
 			}
 			_, err = doOrderWithRetry(10, func() (interface{}, error) {
-				return b.impl.CancelOrder(&oi.Order)
+				return b.impl.CancelOrder(&od)
 			})
 			if err != nil {
 				log.Errorf("cancel order local %s, id %s failed: %s", oi.LocalID, oi.OrderID, err.Error())
 			}
 			continue
+		} else if v.Action == AmendOne {
+			b.amendOrder(v)
+			continue
+		} else if v.Action == resizeLeg {
+			b.resizeOrder(v)
+			continue
+		}
+		// options are loaded by new orders only, so cancel or amend won't drop the option of order sent later
+		opt, _ := b.orderOptions.LoadAndDelete(v.ID)
+		if v.Action.IsStop() && b.isLocalStop(opt) {
+			// hook the stop order when localStopOrder enabled
+			stop := &localStop{TradeAction: v}
+			stop.opt, _ = opt.(OrderOption)
+			b.stopOrders.Store(v.ID, stop)
+			b.newOrderUpdate(v)
+			continue
 		}
 		ret, err = doOrderWithRetry(10, func() (interface{}, error) {
-			order, e := b.impl.ProcessOrder(v)
-			return order, e
+			return b.processOrder(v, opt)
 		})
 		if err == nil {
 			od := ret.(*Order)
-			oi := &OrderInfo{Order: *od, Action: v.Action, LocalID: v.ID}
+			oi := &OrderInfo{Order: *od, Action: v.Action, LocalID: v.ID, state: OrderNew}
+			b.orderMutex.Lock()
 			b.orders[od.OrderID] = oi
 			b.localOrderIndex[v.ID] = oi
+			b.orderMutex.Unlock()
+			b.newOrderUpdate(v)
 		} else {
-			tr := Trade{ID: v.ID,
-				Action: v.Action,
-				Time:   v.Time,
-				Price:  v.Price,
-				Amount: v.Amount,
-				// Side:   v.Action,
-				Remark: "failed:" + err.Error()}
-			b.Send(v.ID, EventTrade, &tr)
+			log.Errorf("TradeExchange process order %s failed: %s", v.ID, err.Error())
+			b.orderUpdate(v, OrderRejected, 0, err.Error())
 		}
 
 	}
 }
 
+// processOrder send order with its option, the order is rejected if the exchange doesn't support its option,
+// orders are sent with position side in hedge mode
+func (b *TradeExchange) processOrder(act TradeAction, value interface{}) (order *Order, err error) {
+	opt, ok := value.(OrderOption)
+	if hedgeEx, isHedge := b.impl.(HedgeExchange); b.hedge && isHedge {
+		return hedgeEx.ProcessHedgeOrder(act, opt)
+	}
+	if !ok || (opt.IsGTC() && !opt.IsTrailing()) {
+		return b.impl.ProcessOrder(act)
+	}
+	optEx, ok := b.impl.(OrderOptionExchange)
+	if !ok {
+		err = fmt.Errorf("%w: %s not support time in force %s", ErrUnsupportOption, b.exchangeName, opt.TimeInForce)
+		return
+	}
+	return optEx.ProcessOrderWithOption(act, opt)
+}
+
+// isLocalStop return true if the stop order should be emulated locally,
+// trailing stop is emulated if the exchange doesn't support order options or the trailing stop
+func (b *TradeExchange) isLocalStop(value interface{}) bool {
+	if b.localStopOrder {
+		return true
+	}
+	opt, ok := value.(OrderOption)
+	if !ok || !opt.IsTrailing() {
+		return false
+	}
+	if _, native := b.impl.(OrderOptionExchange); native {
+		tex, ok := b.impl.(TrailingStopExchange)
+		if !ok || tex.IsNativeTrailing(opt) {
+			return false
+		}
+	}
+	log.Warnf("%s not support trailing stop, emulate it locally", b.exchangeName)
+	return true
+}
+
+// onOrder update the order with its status from exchange, orders are updated under orderMutex
+// and the events are sent after unlock
+func (b *TradeExchange) onOrder(value *Order) {
+	// update time of order from exchange, local time if unknown
+	tm := value.Time
+	if tm.IsZero() {
+		tm = b.Now()
+	}
+	b.orderMutex.Lock()
+	o, ok := b.orders[value.OrderID]
+	if !ok || o.Filled {
+		b.orderMutex.Unlock()
+		return
+	}
+	o.Order = *value
+	filled := value.Filled
+	if value.Status == OrderStatusFilled && filled == 0 {
+		filled = value.Amount
+	}
+	done := value.Status == OrderStatusFilled || (value.Status == OrderStatusCanceled && !o.replaced)
+	state := orderState(value.Status, filled)
+	changed := filled > o.grouped || state != o.state
+	fillGroup := filled > o.grouped || done
+	groupFilled := filled - o.grouped
+	o.grouped = math.Max(o.grouped, filled)
+	// every fill is sent as trade with its amount and price
+	var tr Trade
+	var hasTrade, noPrice bool
+	if filled > o.filled {
+		tr, hasTrade = o.fill(value.Price, filled, value.Status == OrderStatusFilled, tm)
+		noPrice = !hasTrade
+	}
+	// the canceled order replaced by amend is not reported
+	var update bool
+	var act TradeAction
+	if changed && state != "" && !(o.replaced && state == OrderCanceled) {
+		o.state = state
+		update, act = true, o.action()
+	}
+	if value.Status == OrderStatusFilled {
+		o.Filled = true
+	}
+	if state.IsFinal() {
+		b.removeOrder(o)
+	}
+	localID, total := o.LocalID, o.prevFilled+filled
+	b.orderMutex.Unlock()
+
+	if fillGroup {
+		b.fillGroups(localID, groupFilled, done)
+	}
+	if hasTrade {
+		b.Send(value.OrderID, EventTrade, &tr)
+	} else if noPrice {
+		log.Warnf("TradeExchange order %s filled %f without price, trade is sent when price is known", value.OrderID, filled)
+	}
+	if update {
+		b.orderUpdate(act, state, total, "")
+	}
+}
+
+// removeOrder remove the finished order from indexes, the order replaced by amend is only removed from orders,
+// orderMutex must be held
+func (b *TradeExchange) removeOrder(o *OrderInfo) {
+	delete(b.orders, o.OrderID)
+	if b.localOrderIndex[o.LocalID] == o {
+		delete(b.localOrderIndex, o.LocalID)
+	}
+}
+
+// newOrderUpdate report the order accepted, legs of group are reported when they are added
+func (b *TradeExchange) newOrderUpdate(act TradeAction) {
+	if b.isGroupLeg(act.ID) {
+		return
+	}
+	b.orderUpdate(act, OrderNew, 0, "")
+}
+
+// orderUpdate send status update of order to strategy
+func (b *TradeExchange) orderUpdate(act TradeAction, status OrderState, filled float64, reason string) {
+	b.Send(act.ID, EventOrderStatus, &OrderUpdate{Action: act, Status: status, Filled: filled, Reason: reason, Time: b.Now()})
+}
+
 func (b *TradeExchange) cancelAllOrder() {
 	ret, err := doOrderWithRetry(10, func() (interface{}, error) {
 		orders, err := b.impl.CancelAllOrders()
@@ -328,12 +597,12 @@ func (b *TradeExchange) emitCandles(param CandleParam) {
 	}
 	watchParam := exchange.WatchCandle(param.Symbol, param.BinSize)
 	b.candleParam = param
-	err := b.impl.Watch(watchParam, func(data interface{}) {
+	err := b.watch(watchParam, func(data interface{}) {
 		candle := data.(*Candle)
 		b.datas <- candle
 	})
 	if err != nil {
-		log.Errorf("emitCandles wathKline failed:", err.Error())
+		log.Errorf("emitCandles wathKline failed: %s", err.Error())
 		return
 	}
 }
@@ -0,0 +1,817 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ztrade/exchange"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+	"github.com/ztrade/ztrade/pkg/process/vex"
+)
+
+// fakeExchange exchange which records the requests, orders are accepted and wait for updates
+type fakeExchange struct {
+	nOrder   int
+	acts     []TradeAction
+	opts     []OrderOption
+	canceled []string
+	// cancelFilled filled amount of order when it is canceled
+	cancelFilled map[string]float64
+	// watches functions of subscriptions by stream type
+	watches map[string][]exchange.WatchFn
+	klines  []*Candle
+}
+
+func newFakeExchange() *fakeExchange {
+	return &fakeExchange{cancelFilled: make(map[string]float64), watches: make(map[string][]exchange.WatchFn)}
+}
+
+func (f *fakeExchange) Info() exchange.ExchangeInfo {
+	return exchange.ExchangeInfo{Name: "fake"}
+}
+
+func (f *fakeExchange) Symbols() ([]Symbol, error) {
+	return nil, nil
+}
+
+func (f *fakeExchange) Start() error {
+	return nil
+}
+
+func (f *fakeExchange) Stop() error {
+	return nil
+}
+
+func (f *fakeExchange) Watch(param exchange.WatchParam, fn exchange.WatchFn) error {
+	f.watches[param.Type] = append(f.watches[param.Type], fn)
+	return nil
+}
+
+func (f *fakeExchange) GetKline(symbol, bSize string, start, end time.Time) (data []*Candle, err error) {
+	for _, v := range f.klines {
+		if !v.Time().Before(start) && v.Time().Before(end) {
+			data = append(data, v)
+		}
+	}
+	return
+}
+
+func (f *fakeExchange) ProcessOrder(act TradeAction) (ret *Order, err error) {
+	f.nOrder++
+	f.acts = append(f.acts, act)
+	side := "SELL"
+	if act.Action.IsLong() {
+		side = "BUY"
+	}
+	ret = &Order{OrderID: fmt.Sprintf("ex%d", f.nOrder), Symbol: act.Symbol, Amount: act.Amount, Price: act.Price, Status: "NEW", Side: side, Time: act.Time}
+	return
+}
+
+func (f *fakeExchange) CancelAllOrders() (orders []*Order, err error) {
+	return
+}
+
+func (f *fakeExchange) CancelOrder(old *Order) (order *Order, err error) {
+	f.canceled = append(f.canceled, old.OrderID)
+	o := *old
+	o.Status = OrderStatusCanceled
+	o.Filled = f.cancelFilled[old.OrderID]
+	return &o, nil
+}
+
+// optionExchange fake exchange which supports order options
+type optionExchange struct {
+	*fakeExchange
+}
+
+func (f optionExchange) ProcessOrderWithOption(act TradeAction, opt OrderOption) (ret *Order, err error) {
+	f.opts = append(f.opts, opt)
+	return f.ProcessOrder(act)
+}
+
+// amendExchange fake exchange which amends orders natively
+type amendExchange struct {
+	*fakeExchange
+}
+
+func (f amendExchange) AmendOrder(old *Order, price, amount float64) (ret *Order, err error) {
+	o := *old
+	o.Price, o.Amount = price, amount
+	return &o, nil
+}
+
+// reconcileExchange fake exchange with open orders and positions
+type reconcileExchange struct {
+	*fakeExchange
+	openOrders []*OpenOrder
+	positions  []*Position
+}
+
+func (f reconcileExchange) GetOpenOrders(symbol string) (orders []*OpenOrder, err error) {
+	return f.openOrders, nil
+}
+
+func (f reconcileExchange) GetPositions(symbol string) (positions []*Position, err error) {
+	return f.positions, nil
+}
+
+// hedgeExchange fake exchange which supports hedge mode
+type hedgeExchange struct {
+	*fakeExchange
+	hedgeActs []TradeAction
+}
+
+func (f *hedgeExchange) ProcessHedgeOrder(act TradeAction, opt OrderOption) (ret *Order, err error) {
+	f.hedgeActs = append(f.hedgeActs, act)
+	return f.ProcessOrder(act)
+}
+
+type recorder struct {
+	BaseProcesser
+	updates []OrderUpdate
+	trades  []Trade
+	amends  []OrderAmend
+}
+
+func (r *recorder) Init(bus *Bus) (err error) {
+	r.BaseProcesser.Init(bus)
+	r.Subscribe(EventOrderStatus, func(e *Event) error {
+		r.updates = append(r.updates, *e.GetData().(*OrderUpdate))
+		return nil
+	})
+	r.Subscribe(EventTrade, func(e *Event) error {
+		r.trades = append(r.trades, *e.GetData().(*Trade))
+		return nil
+	})
+	r.Subscribe(EventOrderAmend, func(e *Event) error {
+		r.amends = append(r.amends, *e.GetData().(*OrderAmend))
+		return nil
+	})
+	return
+}
+
+// newTestExchange create TradeExchange without starting its routines,
+// they are run by flushOrders and feed until the queued data is processed
+func newTestExchange(t *testing.T, impl exchange.Exchange) (param *BaseProcesser, ex *TradeExchange, rec *recorder) {
+	param = NewBaseProcesser("param")
+	ex = NewTradeExchange("fake", impl, "BTCUSDT")
+	ex.actChan = make(chan TradeAction, 100)
+	rec = &recorder{BaseProcesser: BaseProcesser{Name: "recorder"}}
+	bus := NewSyncBus()
+	for _, v := range []Processer{param, ex, rec} {
+		err := v.Init(bus)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	bus.Start()
+	return
+}
+
+// flushOrders process the queued orders
+func flushOrders(ex *TradeExchange) {
+	close(ex.actChan)
+	ex.orderRoutine()
+	ex.actChan = make(chan TradeAction, 100)
+}
+
+// feed process the datas of exchange
+func feed(ex *TradeExchange, datas ...interface{}) {
+	ch := ex.datas
+	ex.datas = make(chan interface{}, len(datas))
+	for _, v := range datas {
+		ex.datas <- v
+	}
+	close(ex.datas)
+	ex.recvDatas()
+	ex.datas = ch
+}
+
+func TestOrderOptionUnsupported(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, fake)
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{TimeInForce: IOC})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{TimeInForce: GTC})
+	flushOrders(ex)
+	if len(fake.acts) != 1 || fake.acts[0].ID != "2" {
+		t.Fatalf("IOC order should not be sent as GTC: %#v", fake.acts)
+	}
+	if len(rec.updates) != 2 || rec.updates[0].Status != OrderRejected || rec.updates[1].Status != OrderNew {
+		t.Fatalf("IOC order should be rejected: %#v", rec.updates)
+	}
+
+	fake = newFakeExchange()
+	param, ex, rec = newTestExchange(t, optionExchange{fake})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{TimeInForce: FOK})
+	flushOrders(ex)
+	if len(fake.opts) != 1 || fake.opts[0].TimeInForce != FOK || rec.updates[0].Status != OrderNew {
+		t.Fatalf("FOK order should be sent with option: %#v %#v", fake.opts, rec.updates)
+	}
+	_, err := ex.processOrder(TradeAction{ID: "3", Action: OpenLong}, OrderOption{TimeInForce: PostOnly})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = NewTradeExchange("fake", newFakeExchange(), "BTCUSDT").processOrder(TradeAction{ID: "3", Action: OpenLong}, OrderOption{TimeInForce: PostOnly})
+	if !errors.Is(err, ErrUnsupportOption) {
+		t.Fatalf("PostOnly order should be rejected: %v", err)
+	}
+}
+
+func TestAmendOrder(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, amendExchange{fake})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Price: 99, Amount: 3, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	oi := ex.localOrderIndex["1"]
+	if len(fake.canceled) != 0 || len(rec.amends) != 1 || rec.amends[0].Reason != "" || oi.Price != 99 || oi.Amount != 3 {
+		t.Fatalf("order should be amended natively: %#v %#v", rec.amends, oi)
+	}
+
+	fake = newFakeExchange()
+	param, ex, rec = newTestExchange(t, fake)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 0.5, Status: "PARTIALLY_FILLED"})
+	// filled 1.2 in total before canceled
+	fake.cancelFilled["ex1"] = 1.2
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Price: 99, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	if len(fake.acts) != 2 || fake.acts[1].Amount != 0.8 || fake.acts[1].Price != 99 || rec.amends[0].Reason != "" {
+		t.Fatalf("replacement should be sized by the filled amount of cancel: %#v %#v", fake.acts, rec.amends)
+	}
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 1.2, Status: OrderStatusCanceled},
+		&Order{OrderID: "ex2", Symbol: "BTCUSDT", Amount: 0.8, Price: 99, Filled: 0.8, Status: OrderStatusFilled})
+	last := rec.updates[len(rec.updates)-1]
+	if last.Status != OrderFilled || last.Filled != 2 {
+		t.Fatalf("replaced order should be filled in full: %#v", rec.updates)
+	}
+	for _, v := range rec.updates {
+		if v.Status == OrderCanceled {
+			t.Fatalf("canceled order replaced should not be reported: %#v", rec.updates)
+		}
+	}
+	var amount float64
+	for _, v := range rec.trades {
+		amount += v.Amount
+	}
+	if len(rec.trades) != 3 || math.Abs(amount-2) > 1e-9 {
+		t.Fatalf("trades of both orders should be sent: %#v", rec.trades)
+	}
+
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Price: 98, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	if len(rec.amends) != 2 || rec.amends[1].Reason != "order not found" {
+		t.Fatalf("filled order can't be amended: %#v", rec.amends)
+	}
+}
+
+func TestAmendFilledBeforeCancel(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, fake)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	fake.cancelFilled["ex1"] = 2
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Price: 99, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	if len(fake.acts) != 1 || rec.amends[0].Reason == "" || ex.localOrderIndex["1"].replaced {
+		t.Fatalf("order filled before canceled should not be replaced: %#v %#v", fake.acts, rec.amends)
+	}
+}
+
+func TestGroupLegResize(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, fake)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "entry", Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "tp", Action: CloseLong, Price: 110, Amount: 2, Symbol: "BTCUSDT"}, &OrderOption{GroupID: "g", ParentID: "entry"})
+	flushOrders(ex)
+	if len(fake.acts) != 1 {
+		t.Fatalf("leg should wait for parent: %#v", fake.acts)
+	}
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 1, Status: "PARTIALLY_FILLED"})
+	flushOrders(ex)
+	if len(fake.acts) != 2 || fake.acts[1].ID != "tp" || fake.acts[1].Amount != 1 {
+		t.Fatalf("leg should be placed with the filled amount of parent: %#v", fake.acts)
+	}
+	// leg is filled 0.3 before it is resized
+	fake.cancelFilled["ex2"] = 0.3
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 2, Status: OrderStatusFilled})
+	flushOrders(ex)
+	if len(fake.canceled) != 1 || len(fake.acts) != 3 || math.Abs(fake.acts[2].Amount-1.7) > 1e-9 {
+		t.Fatalf("leg should be resized by the filled amount of cancel: %#v %#v", fake.canceled, fake.acts)
+	}
+	feed(ex, &Order{OrderID: "ex2", Symbol: "BTCUSDT", Amount: 1, Price: 110, Filled: 0.3, Status: OrderStatusCanceled})
+	flushOrders(ex)
+	if len(fake.acts) != 3 || len(fake.canceled) != 1 {
+		t.Fatalf("leg should not be resized again: %#v %#v", fake.canceled, fake.acts)
+	}
+	for _, v := range rec.updates {
+		if v.Action.ID == "tp" && v.Status == OrderCanceled {
+			t.Fatalf("resized leg should not be reported as canceled: %#v", rec.updates)
+		}
+	}
+	if len(rec.amends) != 0 {
+		t.Fatalf("resize should not be reported as amend: %#v", rec.amends)
+	}
+	feed(ex, &Order{OrderID: "ex3", Symbol: "BTCUSDT", Amount: 1.7, Price: 110, Filled: 1.7, Status: OrderStatusFilled})
+	last := rec.updates[len(rec.updates)-1]
+	if last.Action.ID != "tp" || last.Status != OrderFilled || math.Abs(last.Filled-2) > 1e-9 {
+		t.Fatalf("leg should be filled in full: %#v", last)
+	}
+	if len(ex.groups) != 0 || len(ex.groupLegs) != 0 {
+		t.Fatalf("finished group should be removed: %#v", ex.groups)
+	}
+}
+
+func TestGroupLegOption(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, optionExchange{fake})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "entry", Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "tp", Action: CloseLong, Price: 110, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{TimeInForce: PostOnly, GroupID: "g", ParentID: "entry"})
+	flushOrders(ex)
+	var news []string
+	for _, v := range rec.updates {
+		if v.Status == OrderNew {
+			news = append(news, v.Action.ID)
+		}
+	}
+	if fmt.Sprint(news) != "[tp entry]" {
+		t.Fatalf("held leg should be reported as new: %v", news)
+	}
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 1, Price: 100, Filled: 1, Status: OrderStatusFilled})
+	flushOrders(ex)
+	if len(fake.acts) != 2 || len(fake.opts) != 1 || fake.opts[0].TimeInForce != PostOnly || fake.opts[0].IsGrouped() {
+		t.Fatalf("leg should be sent with its option: %#v %#v", fake.acts, fake.opts)
+	}
+	n := 0
+	for _, v := range rec.updates {
+		if v.Action.ID == "tp" && v.Status == OrderNew {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("leg should be reported as new once: %#v", rec.updates)
+	}
+}
+
+func TestGroupOCO(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, amendExchange{fake})
+	param.Send("BTCUSDT", EventPosition, &Position{Symbol: "BTCUSDT", Hold: 1})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "tp", Action: CloseLong, Price: 110, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{GroupID: "g"})
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "sl", Action: CloseLong, Price: 90, Amount: 1, Symbol: "BTCUSDT"}, &OrderOption{GroupID: "g"})
+	flushOrders(ex)
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 1, Price: 110, Filled: 0.4, Status: "PARTIALLY_FILLED"})
+	flushOrders(ex)
+	other := ex.localOrderIndex["sl"]
+	if len(fake.acts) != 2 || len(fake.canceled) != 0 || math.Abs(other.Amount-0.6) > 1e-9 {
+		t.Fatalf("other leg should be amended to the amount not filled: %#v %#v", fake.acts, other)
+	}
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 1, Price: 110, Filled: 1, Status: OrderStatusFilled})
+	flushOrders(ex)
+	if len(fake.canceled) != 1 || fake.canceled[0] != "ex2" || len(rec.amends) != 0 {
+		t.Fatalf("other leg should be canceled when group is filled: %#v", fake.canceled)
+	}
+}
+
+func newReconcileExchange() reconcileExchange {
+	return reconcileExchange{
+		fakeExchange: newFakeExchange(),
+		openOrders: []*OpenOrder{
+			{Order: Order{OrderID: "o1", Symbol: "BTCUSDT", Amount: 1, Price: 110, Filled: 0.4, Status: "PARTIALLY_FILLED", Side: "SELL"}, Action: CloseLong},
+			{Order: Order{OrderID: "o2", Symbol: "ETHUSDT", Amount: 1, Price: 10, Status: "NEW", Side: "BUY"}, Action: OpenLong},
+		},
+		positions: []*Position{{Symbol: "BTCUSDT", Type: Long, Hold: 2, Price: 100}},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	fake := newReconcileExchange()
+	_, ex, rec := newTestExchange(t, fake)
+	err := ex.reconcileOnStart()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	oi, ok := ex.localOrderIndex["o1"]
+	if !ok || len(ex.orders) != 1 || oi.Action != CloseLong || oi.filled != 0.4 {
+		t.Fatalf("open order should be adopted with its action: %#v", ex.orders)
+	}
+	if len(rec.updates) != 1 || rec.updates[0].Status != OrderPartiallyFilled || len(ex.datas) != 1 {
+		t.Fatalf("adopted order and position should be sent: %#v %d", rec.updates, len(ex.datas))
+	}
+	feed(ex, &Order{OrderID: "o1", Symbol: "BTCUSDT", Amount: 1, Price: 110, Filled: 1, Status: OrderStatusFilled})
+	if len(rec.trades) != 1 || rec.trades[0].Action != CloseLong || math.Abs(rec.trades[0].Amount-0.6) > 1e-9 {
+		t.Fatalf("adopted order should only send the newly filled part: %#v", rec.trades)
+	}
+
+	fake = newReconcileExchange()
+	fake.openOrders[0].Action = 0
+	_, ex, _ = newTestExchange(t, fake)
+	err = ex.reconcileOnStart()
+	if err == nil {
+		t.Fatalf("order without action should not be adopted")
+	}
+
+	fake = newReconcileExchange()
+	fake.openOrders[0].Action = StopLong
+	_, ex, _ = newTestExchange(t, fake)
+	err = ex.reconcileOnStart()
+	if err != nil || ex.localOrderIndex["o1"].Action != StopLong {
+		t.Fatalf("stop order should be adopted: %v", err)
+	}
+
+	fake = newReconcileExchange()
+	_, ex, _ = newTestExchange(t, fake)
+	ex.SetReconcilePolicy(ReconcileCancel)
+	err = ex.reconcileOnStart()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(fake.canceled) != 1 || fake.canceled[0] != "o1" || len(ex.orders) != 0 || len(fake.acts) != 0 {
+		t.Fatalf("open order should be canceled: %#v %#v", fake.canceled, ex.orders)
+	}
+
+	fake = newReconcileExchange()
+	fake.positions = append(fake.positions, &Position{Symbol: "BTCUSDT", Type: Short, Hold: -1})
+	_, ex, _ = newTestExchange(t, fake)
+	ex.SetReconcilePolicy(ReconcileFlatten)
+	err = ex.reconcileOnStart()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(fake.canceled) != 1 || len(fake.acts) != 2 || fake.acts[0].Action != Market|CloseLong || fake.acts[0].Amount != 2 ||
+		fake.acts[1].Action != Market|CloseShort || fake.acts[1].Amount != 1 {
+		t.Fatalf("positions should be closed with market orders: %#v", fake.acts)
+	}
+}
+
+func TestReconcileUnsupported(t *testing.T) {
+	_, ex, _ := newTestExchange(t, newFakeExchange())
+	err := ex.reconcileOnStart()
+	if err != nil {
+		t.Fatalf("reconcile should be skipped if not configured: %s", err.Error())
+	}
+	ex.SetReconcilePolicy(ReconcileAdopt)
+	err = ex.reconcileOnStart()
+	if !errors.Is(err, ErrUnsupportReconcile) {
+		t.Fatalf("configured reconcile should fail if exchange doesn't support: %v", err)
+	}
+}
+
+func TestHedgeMode(t *testing.T) {
+	_, ex, _ := newTestExchange(t, newFakeExchange())
+	ex.UseHedgeMode(true)
+	err := ex.Start()
+	if !errors.Is(err, ErrUnsupportHedge) {
+		t.Fatalf("hedge mode should fail if exchange can't send position side: %v", err)
+	}
+
+	fake := &hedgeExchange{fakeExchange: newFakeExchange()}
+	param, ex, _ := newTestExchange(t, fake)
+	ex.UseHedgeMode(true)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenShort, Price: 100, Amount: 1, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	if len(fake.hedgeActs) != 1 || fake.hedgeActs[0].Action != OpenShort {
+		t.Fatalf("order should be sent with position side in hedge mode: %#v", fake.hedgeActs)
+	}
+	var positions []HedgePosition
+	param.Subscribe(EventHedgePosition, func(e *Event) error {
+		positions = append(positions, *e.GetData().(*HedgePosition))
+		return nil
+	})
+	feed(ex, &Position{Symbol: "BTCUSDT", Type: Long, Hold: 2, Price: 100},
+		&Position{Symbol: "BTCUSDT", Type: Short, Hold: -1, Price: 101},
+		// leg of position without type and hold is unknown
+		&Position{Symbol: "BTCUSDT", Hold: 0},
+		&Position{Symbol: "BTCUSDT", Type: Short, Hold: 0})
+	if len(positions) != 3 {
+		t.Fatalf("position without type and hold should be ignored: %#v", positions)
+	}
+	last := positions[2]
+	if last.Long.Hold != 2 || last.Short.Hold != 0 || ex.pos.Hold != 2 {
+		t.Fatalf("closed short leg should not change long leg: %#v %#v", last, ex.pos)
+	}
+}
+
+func TestOrderState(t *testing.T) {
+	cases := []struct {
+		status string
+		filled float64
+		state  OrderState
+	}{
+		{"NEW", 0, OrderNew},
+		{"NEW", 1, OrderPartiallyFilled},
+		{"PARTIALLY_FILLED", 1, OrderPartiallyFilled},
+		{"partially_filled", 0, OrderNew},
+		{OrderStatusFilled, 1, OrderFilled},
+		{OrderStatusCanceled, 1, OrderCanceled},
+		{"CANCELLED", 0, OrderCanceled},
+		{"EXPIRED", 0, OrderExpired},
+		{"REJECTED", 0, OrderRejected},
+		{"PENDING", 0, ""},
+	}
+	for _, v := range cases {
+		state := orderState(v.status, v.filled)
+		if state != v.state {
+			t.Errorf("state of %s filled %f should be %s, got %s", v.status, v.filled, v.state, state)
+		}
+	}
+}
+
+func TestOrderFill(t *testing.T) {
+	type update struct {
+		price   float64
+		filled  float64
+		average bool
+	}
+	cases := []struct {
+		name    string
+		updates []update
+		// trades price and amount of trades sent, 0 price means no trade
+		trades [][2]float64
+	}{
+		{"filled at once", []update{{100, 2, true}}, [][2]float64{{100, 2}}},
+		{"partial fills at limit price", []update{{100, 1, false}, {100, 3, false}}, [][2]float64{{100, 1}, {100, 2}}},
+		{"last part from average", []update{{100, 1, false}, {102, 2, true}}, [][2]float64{{100, 1}, {104, 1}}},
+		{"market order without price", []update{{0, 1, false}, {101, 2, true}}, [][2]float64{{0, 0}, {101, 2}}},
+		{"no new fill", []update{{100, 1, false}, {100, 1, false}}, [][2]float64{{100, 1}, {0, 0}}},
+	}
+	for _, c := range cases {
+		o := &OrderInfo{LocalID: "1", Order: Order{OrderID: "ex1"}, Action: OpenLong}
+		for i, u := range c.updates {
+			tm := time.Unix(int64(1600000000+i), 0)
+			tr, ok := o.fill(u.price, u.filled, u.average, tm)
+			want := c.trades[i]
+			if ok != (want[0] != 0) || (ok && (math.Abs(tr.Price-want[0]) > 1e-9 || math.Abs(tr.Amount-want[1]) > 1e-9 || !tr.Time.Equal(tm))) {
+				t.Errorf("%s: update %d should send trade %v, got %v %#v", c.name, i, want, ok, tr)
+			}
+		}
+	}
+}
+
+func TestFinishedOrderRemoved(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, rec := newTestExchange(t, fake)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: Market | OpenLong, Amount: 2, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 0.5, Status: "PARTIALLY_FILLED"},
+		&Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 0.5, Status: OrderStatusCanceled},
+		&Order{OrderID: "ex2", Symbol: "BTCUSDT", Amount: 2, Filled: 1, Status: "PARTIALLY_FILLED"},
+		&Order{OrderID: "ex2", Symbol: "BTCUSDT", Amount: 2, Price: 101, Filled: 2, Status: OrderStatusFilled})
+	if len(ex.orders) != 0 || len(ex.localOrderIndex) != 0 {
+		t.Fatalf("finished orders should be removed: %#v %#v", ex.orders, ex.localOrderIndex)
+	}
+	if len(rec.trades) != 2 || rec.trades[1].ID != "2" || rec.trades[1].Amount != 2 || rec.trades[1].Price != 101 || rec.trades[1].Time.IsZero() {
+		t.Fatalf("fill without price should be sent with the next price: %#v", rec.trades)
+	}
+	var states []OrderState
+	for _, v := range rec.updates {
+		states = append(states, v.Status)
+	}
+	want := []OrderState{OrderNew, OrderNew, OrderPartiallyFilled, OrderCanceled, OrderPartiallyFilled, OrderFilled}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("order states should be %v, got %v", want, states)
+	}
+}
+
+// journal records orders, order status and trades as TradeTbl does
+type journal struct {
+	BaseProcesser
+	records []*TradeRecord
+}
+
+func (j *journal) Init(bus *Bus) (err error) {
+	j.BaseProcesser.Init(bus)
+	j.Subscribe(EventOrder, func(e *Event) error {
+		j.records = append(j.records, NewActionRecord(e.GetData().(*TradeAction), j.Now()))
+		return nil
+	})
+	j.Subscribe(EventOrderStatus, func(e *Event) error {
+		j.records = append(j.records, NewOrderRecord(e.GetData().(*OrderUpdate)))
+		return nil
+	})
+	j.Subscribe(EventTrade, func(e *Event) error {
+		j.records = append(j.records, NewTradeRecord(e.GetData().(*Trade)))
+		return nil
+	})
+	return
+}
+
+func TestJournalRecords(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, _ := newTestExchange(t, fake)
+	j := &journal{BaseProcesser: BaseProcesser{Name: "journal"}}
+	err := j.Init(ex.Bus)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 101, Amount: 2, Symbol: "BTCUSDT"})
+	flushOrders(ex)
+	feed(ex, &Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 0.5, Status: "PARTIALLY_FILLED"},
+		&Order{OrderID: "ex1", Symbol: "BTCUSDT", Amount: 2, Price: 100.5, Filled: 2, Status: OrderStatusFilled})
+	var kinds []string
+	var amount, cost float64
+	for _, v := range j.records {
+		kinds = append(kinds, v.Kind)
+		if v.OrderID != "1" {
+			t.Fatalf("records should use local order id: %s", v)
+		}
+		if v.Kind == RecordTrade {
+			tr := v.Trade()
+			amount += tr.Amount
+			cost += tr.Amount * tr.Price
+		}
+	}
+	want := []string{RecordAction, RecordOrder, RecordTrade, RecordOrder, RecordTrade, RecordOrder}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Fatalf("records should be %v, got %v", want, kinds)
+	}
+	// trades are stored by fill, so PnL can be computed from the records
+	if amount != 2 || math.Abs(cost/amount-100.5) > 1e-9 {
+		t.Fatalf("trades of records should sum to the fills: %f %f", amount, cost)
+	}
+}
+
+// TestConcurrentOrders place orders while the updates of other orders are received, run with -race
+func TestConcurrentOrders(t *testing.T) {
+	fake := newFakeExchange()
+	ex := NewTradeExchange("fake", fake, "BTCUSDT")
+	bus := NewSyncBus()
+	err := ex.Init(bus)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bus.Start()
+	n := 50
+	ex.actChan = make(chan TradeAction, n)
+	for i := 0; i < n; i++ {
+		ex.actChan <- TradeAction{ID: fmt.Sprint(i), Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"}
+	}
+	flushOrders(ex)
+	ex.datas = make(chan interface{}, n)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ex.recvDatas()
+	}()
+	go func() {
+		defer wg.Done()
+		ex.orderRoutine()
+	}()
+	for i := 0; i < n; i++ {
+		ex.actChan <- TradeAction{ID: fmt.Sprint(n + i), Action: OpenLong, Price: 100, Amount: 1, Symbol: "BTCUSDT"}
+		ex.datas <- &Order{OrderID: fmt.Sprintf("ex%d", i+1), Symbol: "BTCUSDT", Amount: 1, Price: 100, Filled: 1, Status: OrderStatusFilled}
+	}
+	close(ex.actChan)
+	close(ex.datas)
+	wg.Wait()
+	if len(ex.orders) != n || len(ex.localOrderIndex) != n {
+		t.Fatalf("filled orders should be removed and new orders kept: %d %d", len(ex.orders), len(ex.localOrderIndex))
+	}
+}
+
+// TestConcurrentAmend amend orders while their fills are received, run with -race
+func TestConcurrentAmend(t *testing.T) {
+	// logging synchronizes the goroutines, which hides the races
+	level := log.GetLevel()
+	log.SetLevel(log.ErrorLevel)
+	defer log.SetLevel(level)
+	fake := newFakeExchange()
+	ex := NewTradeExchange("fake", fake, "BTCUSDT")
+	bus := NewSyncBus()
+	err := ex.Init(bus)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bus.Start()
+	n := 50
+	ex.actChan = make(chan TradeAction, n)
+	for i := 0; i < n; i++ {
+		ex.actChan <- TradeAction{ID: fmt.Sprint(i), Action: OpenLong, Price: 100, Amount: 2, Symbol: "BTCUSDT"}
+	}
+	flushOrders(ex)
+	ex.datas = make(chan interface{}, n)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ex.recvDatas()
+	}()
+	go func() {
+		defer wg.Done()
+		ex.orderRoutine()
+	}()
+	for i := 0; i < n; i++ {
+		ex.actChan <- TradeAction{ID: fmt.Sprint(i), Action: AmendOne, Price: 99, Symbol: "BTCUSDT"}
+		ex.datas <- &Order{OrderID: fmt.Sprintf("ex%d", i+1), Symbol: "BTCUSDT", Amount: 2, Price: 100, Filled: 1, Status: "PARTIALLY_FILLED"}
+	}
+	close(ex.actChan)
+	close(ex.datas)
+	wg.Wait()
+	if len(ex.localOrderIndex) != n {
+		t.Fatalf("amended orders should be indexed: %d", len(ex.localOrderIndex))
+	}
+}
+
+func TestResubscribeDropOld(t *testing.T) {
+	fake := newFakeExchange()
+	param, ex, _ := newTestExchange(t, fake)
+	ex.SetStaleTimeout(exchange.WatchTypeTradeMarket, time.Minute)
+	ex.SetStaleTimeout(exchange.WatchTypeDepth, time.Minute)
+	param.Send(EventTradeMarket, EventWatch, &WatchParam{Type: EventTradeMarket, Extra: "BTCUSDT"})
+	param.Send(EventDepth, EventWatch, &WatchParam{Type: EventDepth, Extra: "BTCUSDT"})
+	trades, depths := fake.watches[exchange.WatchTypeTradeMarket], fake.watches[exchange.WatchTypeDepth]
+	if len(trades) != 1 || len(depths) != 1 {
+		t.Fatalf("streams should be subscribed: %#v", fake.watches)
+	}
+	trades[0](&Trade{ID: "1"})
+	ex.checkStreams(time.Now().Add(time.Minute * 2))
+	trades, depths = fake.watches[exchange.WatchTypeTradeMarket], fake.watches[exchange.WatchTypeDepth]
+	if len(trades) != 2 || len(depths) != 2 {
+		t.Fatalf("stale streams should be resubscribed: %#v", fake.watches)
+	}
+	// the old subscriptions are still alive
+	trades[0](&Trade{ID: "2"})
+	trades[1](&Trade{ID: "2"})
+	depths[0](&Depth{})
+	depths[1](&Depth{})
+	if len(ex.datas) != 3 {
+		t.Fatalf("data of old subscriptions should be dropped: %d", len(ex.datas))
+	}
+	if tr := (<-ex.datas).(*Trade); tr.ID != "1" {
+		t.Fatalf("data before resubscribe should be kept: %#v", tr)
+	}
+}
+
+func TestResubscribeBackfill(t *testing.T) {
+	fake := newFakeExchange()
+	_, ex, _ := newTestExchange(t, fake)
+	ex.SetStaleTimeout(exchange.WatchTypeCandle, time.Minute)
+	now := time.Now().Truncate(time.Minute)
+	for i := 5; i >= 0; i-- {
+		fake.klines = append(fake.klines, &Candle{Start: now.Add(-time.Minute * time.Duration(i)).Unix()})
+	}
+	ex.emitCandles(CandleParam{Symbol: "BTCUSDT", BinSize: "1m"})
+	ex.lastCandle = fake.klines[1].Start
+	ex.checkStreams(time.Now().Add(time.Minute * 2))
+	fns := fake.watches[exchange.WatchTypeCandle]
+	if len(fns) != 2 {
+		t.Fatalf("candle stream should be resubscribed: %d", len(fns))
+	}
+	fns[0](&Candle{Start: now.Unix()})
+	// the finished candles after the last one are backfilled, the unfinished candle is sent by stream
+	if len(ex.datas) != 3 {
+		t.Fatalf("missed candles should be backfilled: %d", len(ex.datas))
+	}
+	for _, v := range fake.klines[2:5] {
+		if c := (<-ex.datas).(*Candle); c.Start != v.Start {
+			t.Fatalf("backfill candle error: %d %d", c.Start, v.Start)
+		}
+	}
+}
+
+func TestPaperMode(t *testing.T) {
+	fake := newFakeExchange()
+	param := NewBaseProcesser("param")
+	ex := NewTradeExchange("fake", fake, "BTCUSDT")
+	ex.UsePaperMode(true)
+	vexchange := vex.NewVExchange("BTCUSDT")
+	vexchange.SetTickMode(true)
+	rec := &recorder{BaseProcesser: BaseProcesser{Name: "recorder"}}
+	bus := NewSyncBus()
+	for _, v := range []Processer{param, ex, vexchange, rec} {
+		err := v.Init(bus)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	bus.Start()
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 100000})
+	tm := time.Unix(1600000000, 0)
+	feed(ex, &Trade{Time: tm, Price: 100, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 99, Amount: 1, Symbol: "BTCUSDT"})
+	if len(ex.actChan) != 0 {
+		t.Fatal("orders should not be sent to exchange in paper mode")
+	}
+	feed(ex, &Trade{Time: tm.Add(time.Second), Price: 98.5, Amount: 1})
+	if fake.nOrder != 0 || len(rec.trades) != 1 || rec.trades[0].Price != 99 {
+		t.Fatalf("order should be filled by virtual exchange with market trades: %d %#v", fake.nOrder, rec.trades)
+	}
+	err := ex.Start()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ex.Stop()
+	if len(fake.watches) != 0 {
+		t.Fatalf("account streams should not be watched in paper mode: %#v", fake.watches)
+	}
+}
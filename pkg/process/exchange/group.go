@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"math"
+	"strings"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// groupEpsilon leg is not resized if the change is less than it
+const groupEpsilon = 1e-9
+
+// resizeLeg internal action to resize working leg to Amount through the amend path, its result is not sent to strategy
+const resizeLeg TradeType = -4
+
+// groupLeg leg of linked order group
+type groupLeg struct {
+	act TradeAction
+	// opt option of leg without group fields, it's used when the leg is sent
+	opt OrderOption
+	// working amount of leg not filled on exchange
+	working float64
+	// repriced price of working leg is amended
+	repriced bool
+}
+
+// addGroupLeg link order to its group, legs are sent when they can be filled,
+// the leg is reported as new at once even if it's held until its parent is filled
+func (b *TradeExchange) addGroupLeg(act TradeAction, opt OrderOption) {
+	b.groupMutex.Lock()
+	g, ok := b.groups[opt.GroupID]
+	if !ok {
+		g = NewOrderGroup(opt.GroupID, opt.ParentID)
+		b.groups[g.ID] = g
+	}
+	g.AddLeg(act.ID, act.Amount)
+	legOpt := opt
+	legOpt.GroupID, legOpt.ParentID = "", ""
+	b.groupLegs[act.ID] = &groupLeg{act: act, opt: legOpt}
+	acts := b.syncGroup(g)
+	b.groupMutex.Unlock()
+	b.orderUpdate(act, OrderNew, 0, "")
+	for _, v := range acts {
+		b.actChan <- v
+	}
+}
+
+// removeGroupLeg remove the leg canceled by strategy, return false if the leg is not sent to exchange
+func (b *TradeExchange) removeGroupLeg(id string) (sent bool) {
+	b.groupMutex.Lock()
+	defer b.groupMutex.Unlock()
+	leg, ok := b.groupLegs[id]
+	if !ok {
+		return true
+	}
+	sent = leg.working > groupEpsilon
+	delete(b.groupLegs, id)
+	for _, g := range b.groups {
+		g.RemoveLeg(id)
+		if len(g.Legs()) == 0 {
+			delete(b.groups, g.ID)
+		}
+	}
+	return
+}
+
+// amendGroupLeg amend leg of group, return false if id is not a leg
+func (b *TradeExchange) amendGroupLeg(act TradeAction) bool {
+	var acts []TradeAction
+	b.groupMutex.Lock()
+	leg, ok := b.groupLegs[act.ID]
+	if !ok {
+		b.groupMutex.Unlock()
+		return false
+	}
+	if act.Price != 0 && act.Price != leg.act.Price {
+		leg.act.Price = act.Price
+		// working leg is amended with new price by syncGroup
+		leg.repriced = leg.working > groupEpsilon
+	}
+	if act.Amount != 0 {
+		leg.act.Amount = act.Amount
+	}
+	for _, g := range b.groups {
+		if !g.HasLeg(act.ID) {
+			continue
+		}
+		if act.Amount != 0 {
+			g.AddLeg(act.ID, act.Amount)
+		}
+		acts = append(acts, b.syncGroup(g)...)
+	}
+	b.groupMutex.Unlock()
+	for _, v := range acts {
+		b.actChan <- v
+	}
+	b.Send(act.ID, EventOrderAmend, &OrderAmend{Action: act})
+	return true
+}
+
+// isGroupLeg return true if id is a leg of group
+func (b *TradeExchange) isGroupLeg(id string) (ok bool) {
+	b.groupMutex.Lock()
+	_, ok = b.groupLegs[id]
+	b.groupMutex.Unlock()
+	return
+}
+
+// clearGroups remove all groups when all orders are canceled
+func (b *TradeExchange) clearGroups() {
+	b.groupMutex.Lock()
+	b.groups = make(map[string]*OrderGroup)
+	b.groupLegs = make(map[string]*groupLeg)
+	b.groupMutex.Unlock()
+}
+
+// fillGroups record the filled amount of parent or leg, done means the order won't be filled any more
+func (b *TradeExchange) fillGroups(id string, amount float64, done bool) {
+	// local stop order is triggered with suffix
+	id = strings.TrimSuffix(id, "_stop")
+	var acts []TradeAction
+	b.groupMutex.Lock()
+	for _, g := range b.groups {
+		if g.Parent != id && !g.HasLeg(id) {
+			continue
+		}
+		if leg, ok := b.groupLegs[id]; ok && g.HasLeg(id) {
+			leg.working -= amount
+		}
+		g.Fill(id, amount)
+		if done && g.Parent == id {
+			g.SetParentDone()
+		}
+		acts = append(acts, b.syncGroup(g)...)
+	}
+	b.groupMutex.Unlock()
+	for _, v := range acts {
+		b.actChan <- v
+	}
+}
+
+// syncGroup return the actions to resize working legs to the amount they can be filled,
+// working legs are amended so the fills before the amend acknowledged are counted, the group is removed when finished
+func (b *TradeExchange) syncGroup(g *OrderGroup) (acts []TradeAction) {
+	done := g.Done()
+	for _, id := range g.Legs() {
+		leg := b.groupLegs[id]
+		want := g.Remain(id)
+		if done {
+			want = 0
+		}
+		if math.Abs(want-leg.working) <= groupEpsilon && !leg.repriced {
+			continue
+		}
+		leg.repriced = false
+		switch {
+		case leg.working <= groupEpsilon:
+			act := leg.act
+			act.Amount = want
+			b.orderOptions.Store(id, leg.opt)
+			acts = append(acts, act)
+		case want <= groupEpsilon:
+			acts = append(acts, TradeAction{ID: id, Action: CancelOne, Symbol: leg.act.Symbol})
+			want = 0
+		default:
+			acts = append(acts, TradeAction{ID: id, Action: resizeLeg, Amount: want, Price: leg.act.Price, Time: leg.act.Time, Symbol: leg.act.Symbol})
+		}
+		leg.working = want
+	}
+	if done {
+		for _, id := range g.Legs() {
+			delete(b.groupLegs, id)
+		}
+		delete(b.groups, g.ID)
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// UseHedgeMode track long and short positions of exchange in hedge mode independently,
+// the exchange must implement HedgeExchange to send orders with position side
+func (b *TradeExchange) UseHedgeMode(enable bool) {
+	b.hedge = enable
+	if enable {
+		log.Infof("%s TradeExchange use hedge mode", b.exchangeName)
+	}
+}
+
+// onHedgePosition update the leg of position, both legs and the net position are sent to strategy,
+// position without type is the leg of its sign, it is ignored if the hold is 0 as the leg is unknown
+func (b *TradeExchange) onHedgePosition(pos *Position) {
+	leg := PositionLeg{Hold: math.Abs(pos.Hold), Price: pos.Price}
+	switch {
+	case pos.Type == Long || (pos.Type != Short && pos.Hold > 0):
+		b.hedgePos.Long = leg
+	case pos.Type == Short || pos.Hold < 0:
+		b.hedgePos.Short = leg
+	default:
+		log.Warnf("TradeExchange ignore hedge position without type: %#v", pos)
+		return
+	}
+	b.hedgePos.Symbol = pos.Symbol
+	net := Position{Symbol: pos.Symbol, Hold: b.hedgePos.Net(), Price: b.hedgePos.Long.Price}
+	if net.Hold < 0 {
+		net.Price = b.hedgePos.Short.Price
+	}
+	b.pos = net
+	atomic.StoreInt64(&b.positionUpdate, time.Now().Unix())
+	hedge := b.hedgePos
+	b.Send(pos.Symbol, EventHedgePosition, &hedge)
+	b.Send(pos.Symbol, EventPosition, &net)
+}
+
+// holdOf return the position which can be closed by the stop of direction
+func (b *TradeExchange) holdOf(long bool) float64 {
+	if b.hedge {
+		if long {
+			return b.hedgePos.Long.Hold
+		}
+		return b.hedgePos.Short.Hold
+	}
+	if long {
+		return b.pos.Hold
+	}
+	return -b.pos.Hold
+}
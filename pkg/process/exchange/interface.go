@@ -2,8 +2,11 @@ package exchange
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ztrade/exchange"
+	. "github.com/ztrade/ztrade/pkg/core"
+	"github.com/ztrade/ztrade/pkg/process/exchange/binance"
 )
 
 func GetTradeExchange(name string, cfg exchange.Config, cltName, symbol string) (t *TradeExchange, err error) {
@@ -11,8 +14,36 @@ func GetTradeExchange(name string, cfg exchange.Config, cltName, symbol string)
 	if err != nil {
 		return
 	}
+	ex, err = binance.Extend(ex, cfg, cltName)
+	if err != nil {
+		return
+	}
 	t = NewTradeExchange(name, ex, symbol)
 	localStop := cfg.GetBool(fmt.Sprintf("exchanges.%s.localstop", cltName))
 	t.UseLocalStopOrder(localStop)
+	hedge := cfg.GetBool(fmt.Sprintf("exchanges.%s.hedge", cltName))
+	t.UseHedgeMode(hedge)
+	if str := cfg.GetString(fmt.Sprintf("exchanges.%s.reconcile", cltName)); str != "" {
+		var policy ReconcilePolicy
+		policy, err = ParseReconcilePolicy(str)
+		if err != nil {
+			return
+		}
+		t.SetReconcilePolicy(policy)
+	}
+	var stale map[string]string
+	err = cfg.UnmarshalKey(fmt.Sprintf("exchanges.%s.stale", cltName), &stale)
+	if err != nil {
+		return
+	}
+	for k, v := range stale {
+		var timeout time.Duration
+		timeout, err = time.ParseDuration(v)
+		if err != nil {
+			err = fmt.Errorf("parse stale timeout of %s failed: %w", k, err)
+			return
+		}
+		t.SetStaleTimeout(k, timeout)
+	}
 	return
 }
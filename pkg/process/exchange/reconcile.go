@@ -0,0 +1,139 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// SetReconcilePolicy set how the open orders and positions found on exchange are handled when TradeExchange starts,
+// TradeExchange fails to start if the policy is set but the exchange doesn't support reconcile
+func (b *TradeExchange) SetReconcilePolicy(policy ReconcilePolicy) {
+	b.reconcile = policy
+}
+
+// reconcileOnStart fetch open orders and positions from exchange, report the drift from local state,
+// then rebuild the local indexes or cancel and close them by policy,
+// it must be called before recvDatas and orderRoutine start
+func (b *TradeExchange) reconcileOnStart() (err error) {
+	rex, ok := b.impl.(ReconcileExchange)
+	if !ok {
+		if b.reconcile != "" {
+			return fmt.Errorf("%w: %s can't fetch open orders and positions, remove reconcile %s from config", ErrUnsupportReconcile, b.exchangeName, b.reconcile)
+		}
+		log.Warnf("%s not support fetching open orders and positions, skip reconcile", b.exchangeName)
+		return
+	}
+	policy := b.reconcile
+	if policy == "" {
+		policy = ReconcileAdopt
+	}
+	orders, err := rex.GetOpenOrders(b.symbol)
+	if err != nil {
+		return fmt.Errorf("reconcile get open orders failed: %w", err)
+	}
+	positions, err := rex.GetPositions(b.symbol)
+	if err != nil {
+		return fmt.Errorf("reconcile get positions failed: %w", err)
+	}
+	var drifts []string
+	var long, short float64
+	for _, v := range positions {
+		if v.Symbol != b.symbol || v.Hold == 0 {
+			continue
+		}
+		if v.Type == Short || (v.Type != Long && v.Hold < 0) {
+			short += math.Abs(v.Hold)
+		} else {
+			long += math.Abs(v.Hold)
+		}
+	}
+	localLong, localShort := math.Max(b.holdOf(true), 0), math.Max(b.holdOf(false), 0)
+	if long != localLong || short != localShort {
+		drifts = append(drifts, fmt.Sprintf("position long %f short %f, local long %f short %f", long, short, localLong, localShort))
+	}
+	var unknown []*OpenOrder
+	for _, v := range orders {
+		if v.Symbol != b.symbol {
+			continue
+		}
+		b.orderMutex.Lock()
+		_, ok := b.orders[v.OrderID]
+		b.orderMutex.Unlock()
+		if ok {
+			continue
+		}
+		if policy == ReconcileAdopt && v.Action&(Open|Close|Stop) == 0 {
+			return fmt.Errorf("reconcile adopt order %s failed: action of order unknown", v.OrderID)
+		}
+		unknown = append(unknown, v)
+		drifts = append(drifts, fmt.Sprintf("unknown order %s %s %f@%f filled %f", v.OrderID, v.Side, v.Amount, v.Price, v.Filled))
+	}
+	if len(drifts) > 0 {
+		content := fmt.Sprintf("%s %s reconcile with policy %s:\n%s", b.exchangeName, b.symbol, policy, strings.Join(drifts, "\n"))
+		log.Warn(content)
+		b.Send("notify", EventNotify, &NotifyEvent{Type: "text", Title: "Reconcile", Content: content})
+	}
+	for _, v := range unknown {
+		if policy == ReconcileAdopt {
+			b.adoptOrder(v)
+			continue
+		}
+		o := &v.Order
+		_, err = doOrderWithRetry(10, func() (interface{}, error) {
+			return b.impl.CancelOrder(o)
+		})
+		if err != nil {
+			return fmt.Errorf("reconcile cancel order %s failed: %w", o.OrderID, err)
+		}
+		log.Infof("reconcile cancel order %s", o.OrderID)
+	}
+	for _, v := range positions {
+		if v.Symbol == b.symbol {
+			b.datas <- v
+		}
+	}
+	if policy != ReconcileFlatten {
+		return
+	}
+	if long > 0 {
+		err = b.flatten(CloseLong, long)
+	}
+	if err == nil && short > 0 {
+		err = b.flatten(CloseShort, short)
+	}
+	return
+}
+
+// adoptOrder track the order not placed by scripts with the action told by exchange,
+// exchange order id is used as the local id
+func (b *TradeExchange) adoptOrder(order *OpenOrder) {
+	state := orderState(order.Status, order.Filled)
+	if state == "" {
+		state = OrderNew
+	}
+	oi := &OrderInfo{Order: order.Order, Action: order.Action, LocalID: order.OrderID, filled: order.Filled, cost: order.Filled * order.Price, grouped: order.Filled, state: state}
+	b.orderMutex.Lock()
+	b.orders[order.OrderID] = oi
+	b.localOrderIndex[oi.LocalID] = oi
+	b.orderMutex.Unlock()
+	log.Infof("reconcile adopt order %s as %s", order.OrderID, order.Action)
+	b.orderUpdate(oi.action(), state, order.Filled, "")
+}
+
+// flatten close the position with market order
+func (b *TradeExchange) flatten(action TradeType, amount float64) (err error) {
+	act := TradeAction{ID: fmt.Sprintf("reconcile_%s_%s", b.symbol, action), Action: Market | action, Amount: amount, Symbol: b.symbol, Time: b.Now()}
+	_, err = doOrderWithRetry(10, func() (interface{}, error) {
+		return b.processOrder(act, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("reconcile flatten %s %f failed: %w", action, amount, err)
+	}
+	log.Infof("reconcile flatten %s %f", action, amount)
+	return
+}
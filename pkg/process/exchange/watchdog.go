@@ -0,0 +1,163 @@
+package exchange
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ztrade/base/common"
+	"github.com/ztrade/exchange"
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+)
+
+// stream data stream watched from exchange
+type stream struct {
+	param exchange.WatchParam
+	fn    exchange.WatchFn
+	// last time of data received or subscribed
+	last time.Time
+	// gen generation of subscription, data of older subscriptions are dropped
+	gen int
+}
+
+// SetStaleTimeout resubscribe the stream if no data is received for timeout, 0 means never,
+// stream: candle,trade_market,depth,balance,position,trade
+func (b *TradeExchange) SetStaleTimeout(stream string, timeout time.Duration) {
+	b.streamMutex.Lock()
+	b.staleTimeouts[stream] = timeout
+	b.streamMutex.Unlock()
+}
+
+// watch subscribe the stream of exchange, the stream is watched by watchdog
+func (b *TradeExchange) watch(param exchange.WatchParam, fn exchange.WatchFn) (err error) {
+	b.streamMutex.Lock()
+	b.streams[param.Type] = &stream{param: param, fn: fn, last: time.Now()}
+	b.streamMutex.Unlock()
+	return b.impl.Watch(param, b.streamFn(param.Type, 0, fn))
+}
+
+// streamFn wrap fn of subscription gen, the exchange can't unsubscribe the stream,
+// so data of the subscription are dropped after the stream is resubscribed
+func (b *TradeExchange) streamFn(name string, gen int, fn exchange.WatchFn) exchange.WatchFn {
+	return func(data interface{}) {
+		b.streamMutex.Lock()
+		s, ok := b.streams[name]
+		stale := ok && s.gen != gen
+		b.streamMutex.Unlock()
+		if stale {
+			return
+		}
+		fn(data)
+	}
+}
+
+// received record the time of data received
+func (b *TradeExchange) received(data interface{}) {
+	var name string
+	switch data.(type) {
+	case *Candle:
+		name = exchange.WatchTypeCandle
+	case *Trade:
+		name = exchange.WatchTypeTradeMarket
+	case *Depth:
+		name = exchange.WatchTypeDepth
+	case *Balance:
+		name = exchange.WatchTypeBalance
+	case *Position:
+		name = exchange.WatchTypePosition
+	case *Order:
+		name = exchange.WatchTypeTrade
+	default:
+		return
+	}
+	b.streamMutex.Lock()
+	if s, ok := b.streams[name]; ok {
+		s.last = time.Now()
+	}
+	b.streamMutex.Unlock()
+}
+
+// watchdog check the streams until TradeExchange stops
+func (b *TradeExchange) watchdog() {
+	interval := time.Second * 5
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closeCh:
+			return
+		case now := <-ticker.C:
+			b.checkStreams(now)
+		}
+	}
+}
+
+// checkStreams resubscribe the streams which are silent for longer than their timeouts,
+// missed candles are backfilled, the stream is checked again after another timeout,
+// data of the old subscription are dropped unless resubscribe failed
+func (b *TradeExchange) checkStreams(now time.Time) {
+	stales := make(map[string]stream)
+	b.streamMutex.Lock()
+	for name, s := range b.streams {
+		timeout := b.staleTimeouts[name]
+		if timeout <= 0 || now.Sub(s.last) < timeout {
+			continue
+		}
+		s.gen++
+		stales[name] = *s
+		s.last = now
+	}
+	b.streamMutex.Unlock()
+	for name, s := range stales {
+		err := fmt.Errorf("%w: %s %s no data since %s", ErrStaleStream, b.exchangeName, name, s.last.Format(time.RFC3339))
+		log.Warn(err.Error())
+		b.Send("notify", EventNotify, &NotifyEvent{Type: "text", Title: "Stale market data", Content: err.Error()})
+		b.Bus.Send(NewErrorEvent(b.Name, err.Error(), err))
+		if name == exchange.WatchTypeCandle {
+			b.backfillCandles()
+		}
+		err = b.impl.Watch(s.param, b.streamFn(name, s.gen, s.fn))
+		if err != nil {
+			log.Errorf("TradeExchange resubscribe %s failed: %s", name, err.Error())
+			b.streamMutex.Lock()
+			if cur, ok := b.streams[name]; ok && cur.gen == s.gen {
+				cur.gen--
+			}
+			b.streamMutex.Unlock()
+		}
+	}
+}
+
+// backfillCandles load the candles after the last candle received, they are sent in order with the realtime candles
+func (b *TradeExchange) backfillCandles() {
+	last := atomic.LoadInt64(&b.lastCandle)
+	param := b.candleParam
+	if last == 0 || param.Symbol == "" {
+		return
+	}
+	dur, err := common.GetBinSizeDuration(param.BinSize)
+	if err != nil {
+		log.Errorf("TradeExchange backfill candles failed: %s", err.Error())
+		return
+	}
+	end := time.Now()
+	klines, errCh := exchange.KlineChan(b.impl, param.Symbol, param.BinSize, time.Unix(last, 0), end)
+	var n int
+	for v := range klines {
+		// the unfinished candle is sent by stream
+		if v.Start <= last || v.Time().Add(dur).After(end) {
+			continue
+		}
+		b.datas <- v
+		n++
+	}
+	err = <-errCh
+	if err != nil {
+		log.Errorf("TradeExchange backfill candles failed: %s", err.Error())
+		return
+	}
+	log.Infof("TradeExchange backfill %d candles", n)
+}
@@ -37,6 +37,7 @@ type EngineImpl struct {
 	proc        *BaseProcesser
 	pos         float64
 	posPrice    float64
+	hedgePos    HedgePosition
 	balance     float64
 	merges      map[string][]*KlinePlugin
 	mergesMutex sync.Mutex
@@ -97,12 +98,49 @@ func (e *EngineWrapper) DoOrder(typ TradeType, price, amount float64) string {
 	return e.addOrder(price, amount, typ)
 }
 
+// DoOrderWithOption send order with time in force options
+func (e *EngineWrapper) DoOrderWithOption(typ TradeType, price, amount float64, opt OrderOption) string {
+	return e.addOrderWithOption(e.newActionID(), price, amount, typ, &opt)
+}
+
+// Bracket send entry order with take profit and stop loss orders, which work after entry is filled,
+// take profit or stop loss is skipped if its price is 0
+func (e *EngineWrapper) Bracket(entry TradeType, price, amount, takeProfit, stopLoss float64) (entryID, takeProfitID, stopLossID string) {
+	entryID = e.addOrder(price, amount, entry)
+	opt := OrderOption{GroupID: entryID, ParentID: entryID}
+	closeType, stopType := CloseLong, StopLong
+	if !entry.IsLong() {
+		closeType, stopType = CloseShort, StopShort
+	}
+	if takeProfit != 0 {
+		takeProfitID = e.addOrderWithOption(e.newActionID(), takeProfit, amount, closeType, &opt)
+	}
+	if stopLoss != 0 {
+		stopLossID = e.addOrderWithOption(e.newActionID(), stopLoss, amount, stopType, &opt)
+	}
+	return
+}
+
+// OCO send two orders with the same amount, one cancels the other
+func (e *EngineWrapper) OCO(first TradeType, firstPrice float64, second TradeType, secondPrice float64, amount float64) (firstID, secondID string) {
+	firstID = e.newActionID()
+	opt := OrderOption{GroupID: firstID}
+	e.addOrderWithOption(firstID, firstPrice, amount, first, &opt)
+	secondID = e.addOrderWithOption(e.newActionID(), secondPrice, amount, second, &opt)
+	return
+}
+
 func (e *EngineImpl) CancelAllOrder() {
-	e.proc.Send(EventOrder, EventOrder, &TradeAction{Action: CancelAll})
+	e.proc.Send(EventOrder, EventOrder, &TradeAction{Action: CancelAll, Symbol: e.symbol})
 }
 
 func (e *EngineImpl) CancelOrder(id string) {
-	e.proc.Send(EventOrder, EventOrder, &TradeAction{Action: CancelOne, ID: id})
+	e.proc.Send(EventOrder, EventOrder, &TradeAction{Action: CancelOne, ID: id, Symbol: e.symbol})
+}
+
+// AmendOrder amend the price or amount of working order, zero price or amount means unchanged
+func (e *EngineImpl) AmendOrder(id string, price, amount float64) {
+	e.proc.Send(EventOrder, EventOrder, &TradeAction{Action: AmendOne, ID: id, Price: price, Amount: amount, Symbol: e.symbol})
 }
 
 func (e *EngineImpl) AddIndicator(name string, params ...int) (ind indicator.CommonIndicator) {
@@ -123,16 +161,53 @@ func (e *EngineImpl) Position() (float64, float64) {
 	return e.pos, e.posPrice
 }
 
+func (e *EngineImpl) UpdateHedgePosition(pos HedgePosition) {
+	e.hedgePos = pos
+}
+
+// HedgePosition return long and short positions in hedge mode
+func (e *EngineImpl) HedgePosition() HedgePosition {
+	return e.hedgePos
+}
+
 func (e *EngineImpl) Log(v ...interface{}) {
 	fmt.Println(v...)
 }
 
+// Now return current time, it's the time of candle in backtest
+func (e *EngineImpl) Now() time.Time {
+	return e.proc.Now()
+}
+
+// TrailingStopLong stop of long position, the stop price follows the highest price by distance or percent
+func (e *EngineWrapper) TrailingStopLong(distance, percent, amount float64) string {
+	opt := OrderOption{TrailDistance: distance, TrailPercent: percent}
+	return e.addOrderWithOption(e.newActionID(), 0, amount, StopLong, &opt)
+}
+
+// TrailingStopShort stop of short position, the stop price follows the lowest price by distance or percent
+func (e *EngineWrapper) TrailingStopShort(distance, percent, amount float64) string {
+	opt := OrderOption{TrailDistance: distance, TrailPercent: percent}
+	return e.addOrderWithOption(e.newActionID(), 0, amount, StopShort, &opt)
+}
+
+func (e *EngineWrapper) newActionID() string {
+	return fmt.Sprintf("%s-%s", e.VmID, getActionID())
+}
+
 func (e *EngineWrapper) addOrder(price, amount float64, orderType TradeType) (id string) {
-	// FixMe: in backtest, time may be the time of candle
-	id = fmt.Sprintf("%s-%s", e.VmID, getActionID())
-	act := TradeAction{ID: id, Action: orderType, Symbol: e.symbol, Amount: amount, Price: price, Time: time.Now()}
-	e.proc.Send(EventOrder, EventOrder, &act)
-	return
+	return e.addOrderWithOption(e.newActionID(), price, amount, orderType, nil)
+}
+
+// addOrderWithOption send order with id, opt is sent as the extra of order event if not nil
+func (e *EngineWrapper) addOrderWithOption(id string, price, amount float64, orderType TradeType, opt *OrderOption) string {
+	act := TradeAction{ID: id, Action: orderType, Symbol: e.symbol, Amount: amount, Price: price, Time: e.Now()}
+	if opt == nil {
+		e.proc.Send(EventOrder, EventOrder, &act)
+	} else {
+		e.proc.SendWithExtra(EventOrder, EventOrder, &act, opt)
+	}
+	return id
 }
 
 func (e *EngineImpl) Watch(watchType string) {
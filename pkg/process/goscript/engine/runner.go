@@ -7,6 +7,7 @@ import (
 	"github.com/ztrade/base/common"
 	"github.com/ztrade/base/engine"
 	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
 	. "github.com/ztrade/ztrade/pkg/event"
 )
 
@@ -28,6 +29,7 @@ type Runner interface {
 	OnTrade(trade *Trade) (err error)
 	OnTradeMarket(trade *Trade) (err error)
 	OnDepth(depth *Depth) (err error)
+	OnOrder(update *OrderUpdate) (err error)
 	OnEvent(e *Event) (err error)
 	GetName() string
 }
@@ -42,6 +42,7 @@ func NewDefaultGoEngine() (s *GoEngine, err error) {
 func NewGoEngine(symbol string) (s *GoEngine, err error) {
 	s = new(GoEngine)
 	s.Name = "multi_script"
+	s.Symbol = symbol
 	s.vms = make(map[string]*scriptInfo)
 	s.engine = engine.NewEngineWrapper(&s.BaseProcesser, nil, symbol, "")
 	return
@@ -59,6 +60,10 @@ func (s *GoEngine) Init(bus *Bus) (err error) {
 	s.Subscribe(EventTradeMarket, s.onEventTradeMarket)
 	s.Subscribe(EventDepth, s.onEventDepth)
 	s.Subscribe(EventBalance, s.onEventBalance)
+	s.Subscribe(EventKillSwitch, s.onEventKillSwitch)
+	s.Subscribe(EventOrderAmend, s.onEventOrderAmend)
+	s.Subscribe(EventOrderStatus, s.onEventOrderStatus)
+	s.Subscribe(EventHedgePosition, s.onEventHedgePosition)
 	return
 }
 
@@ -207,6 +212,9 @@ func (s *GoEngine) onDepth(depth *Depth) {
 }
 
 func (s *GoEngine) onEventCandle(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
 	ret, ok := e.GetData().(*Candle)
 	if !ok {
 		log.Errorf("onEventCandle type error: %##v", e.GetData())
@@ -223,6 +231,9 @@ func (s *GoEngine) onEventCandle(e *Event) (err error) {
 }
 
 func (s *GoEngine) onEventTrade(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
 	tr, ok := e.GetData().(*Trade)
 	if !ok {
 		log.Errorf("onEventTrade type error: %##v", e.GetData())
@@ -233,6 +244,9 @@ func (s *GoEngine) onEventTrade(e *Event) (err error) {
 }
 
 func (s *GoEngine) onEventPosition(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
 	pos, ok := e.GetData().(*Position)
 	if !ok {
 		log.Errorf("onEventPosition type error: %##v", e.GetData())
@@ -242,6 +256,9 @@ func (s *GoEngine) onEventPosition(e *Event) (err error) {
 	return
 }
 func (s *GoEngine) onEventTradeMarket(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
 	th, ok := e.GetData().(*Trade)
 	if !ok {
 		log.Errorf("onEventTradeMarket type error: %##v", e.GetData())
@@ -252,6 +269,9 @@ func (s *GoEngine) onEventTradeMarket(e *Event) (err error) {
 }
 
 func (s *GoEngine) onEventDepth(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
 	depth, ok := e.GetData().(*Depth)
 	if !ok {
 		log.Errorf("onEventDepth type error: %##v", e.GetData())
@@ -271,6 +291,80 @@ func (s *GoEngine) onEventBalance(e *Event) (err error) {
 	return
 }
 
+func (s *GoEngine) onEventKillSwitch(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
+	info, ok := e.GetData().(*KillSwitch)
+	if !ok {
+		log.Errorf("onEventKillSwitch type error: %##v", e.GetData())
+		return
+	}
+	var names []string
+	s.mutex.Lock()
+	for name := range s.vms {
+		log.Errorf("GoEngine halt script %s: %s", name, info.Reason)
+		s.doRemoveScript(name)
+		names = append(names, name)
+	}
+	s.mutex.Unlock()
+	// status channel may block, send status without lock
+	if s.statusCh == nil {
+		return
+	}
+	for _, name := range names {
+		s.statusCh <- &Status{Name: name, Status: bengine.StatusFail, Msg: "kill switch: " + info.Reason}
+	}
+	return
+}
+
+func (s *GoEngine) onEventOrderStatus(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
+	update, ok := e.GetData().(*OrderUpdate)
+	if !ok {
+		log.Errorf("onEventOrderStatus type error: %##v", e.GetData())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, vm := range s.vms {
+		vm.OnOrder(update)
+	}
+	return
+}
+
+func (s *GoEngine) onEventOrderAmend(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, vm := range s.vms {
+		vm.OnEvent(e)
+	}
+	return
+}
+
+func (s *GoEngine) onEventHedgePosition(e *Event) (err error) {
+	if !s.MatchSymbol(e) {
+		return
+	}
+	pos, ok := e.GetData().(*HedgePosition)
+	if !ok {
+		log.Errorf("onEventHedgePosition type error: %##v", e.GetData())
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.engine.UpdateHedgePosition(*pos)
+	for _, vm := range s.vms {
+		vm.OnEvent(e)
+	}
+	return
+}
+
 func (s *GoEngine) updateScriptStatus(name string, status int, msg string) {
 	// call in script, no need lock
 	switch status {
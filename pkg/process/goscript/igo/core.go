@@ -0,0 +1,68 @@
+package igo
+
+import (
+	q "github.com/ztrade/ztrade/pkg/core"
+
+	"go/constant"
+	"reflect"
+
+	"github.com/goplus/igop"
+)
+
+// init register the order and position types of core used by scripts,
+// only part of core is exported so Deps are the packages used by the exported declarations
+func init() {
+	igop.RegisterPackage(&igop.Package{
+		Name: "core",
+		Path: "github.com/ztrade/ztrade/pkg/core",
+		Deps: map[string]string{
+			"github.com/ztrade/trademodel": "trademodel",
+			"time":                         "time",
+		},
+		Interfaces: map[string]reflect.Type{
+			"ClockEngine":          reflect.TypeOf((*q.ClockEngine)(nil)).Elem(),
+			"HedgePositionEngine":  reflect.TypeOf((*q.HedgePositionEngine)(nil)).Elem(),
+			"HedgePositionHandler": reflect.TypeOf((*q.HedgePositionHandler)(nil)).Elem(),
+			"OrderHandler":         reflect.TypeOf((*q.OrderHandler)(nil)).Elem(),
+			"OrderAmendEngine":     reflect.TypeOf((*q.OrderAmendEngine)(nil)).Elem(),
+			"OrderAmendExchange":   reflect.TypeOf((*q.OrderAmendExchange)(nil)).Elem(),
+			"OrderAmendHandler":    reflect.TypeOf((*q.OrderAmendHandler)(nil)).Elem(),
+			"OrderGroupEngine":     reflect.TypeOf((*q.OrderGroupEngine)(nil)).Elem(),
+			"OrderOptionEngine":    reflect.TypeOf((*q.OrderOptionEngine)(nil)).Elem(),
+			"OrderOptionExchange":  reflect.TypeOf((*q.OrderOptionExchange)(nil)).Elem(),
+			"TrailingStopEngine":   reflect.TypeOf((*q.TrailingStopEngine)(nil)).Elem(),
+			"TrailingStopExchange": reflect.TypeOf((*q.TrailingStopExchange)(nil)).Elem(),
+		},
+		NamedTypes: map[string]reflect.Type{
+			"HedgePosition": reflect.TypeOf((*q.HedgePosition)(nil)).Elem(),
+			"PositionLeg":   reflect.TypeOf((*q.PositionLeg)(nil)).Elem(),
+			"OrderState":    reflect.TypeOf((*q.OrderState)(nil)).Elem(),
+			"OrderUpdate":   reflect.TypeOf((*q.OrderUpdate)(nil)).Elem(),
+			"OrderAmend":    reflect.TypeOf((*q.OrderAmend)(nil)).Elem(),
+			"OrderGroup":    reflect.TypeOf((*q.OrderGroup)(nil)).Elem(),
+			"OrderOption":   reflect.TypeOf((*q.OrderOption)(nil)).Elem(),
+			"TimeInForce":   reflect.TypeOf((*q.TimeInForce)(nil)).Elem(),
+		},
+		AliasTypes: map[string]reflect.Type{},
+		Vars:       map[string]reflect.Value{},
+		Funcs: map[string]reflect.Value{
+			"IsLongLeg":     reflect.ValueOf(q.IsLongLeg),
+			"NewOrderGroup": reflect.ValueOf(q.NewOrderGroup),
+		},
+		TypedConsts: map[string]igop.TypedConst{
+			"OrderCanceled":        {Typ: reflect.TypeOf(q.OrderCanceled), Value: constant.MakeString(string(q.OrderCanceled))},
+			"OrderExpired":         {Typ: reflect.TypeOf(q.OrderExpired), Value: constant.MakeString(string(q.OrderExpired))},
+			"OrderFilled":          {Typ: reflect.TypeOf(q.OrderFilled), Value: constant.MakeString(string(q.OrderFilled))},
+			"OrderNew":             {Typ: reflect.TypeOf(q.OrderNew), Value: constant.MakeString(string(q.OrderNew))},
+			"OrderPartiallyFilled": {Typ: reflect.TypeOf(q.OrderPartiallyFilled), Value: constant.MakeString(string(q.OrderPartiallyFilled))},
+			"OrderRejected":        {Typ: reflect.TypeOf(q.OrderRejected), Value: constant.MakeString(string(q.OrderRejected))},
+			"AmendOne":             {Typ: reflect.TypeOf(q.AmendOne), Value: constant.MakeInt64(int64(q.AmendOne))},
+			"FOK":                  {Typ: reflect.TypeOf(q.FOK), Value: constant.MakeString(string(q.FOK))},
+			"GTC":                  {Typ: reflect.TypeOf(q.GTC), Value: constant.MakeString(string(q.GTC))},
+			"GTD":                  {Typ: reflect.TypeOf(q.GTD), Value: constant.MakeString(string(q.GTD))},
+			"IOC":                  {Typ: reflect.TypeOf(q.IOC), Value: constant.MakeString(string(q.IOC))},
+			"PostOnly":             {Typ: reflect.TypeOf(q.PostOnly), Value: constant.MakeString(string(q.PostOnly))},
+		},
+		UntypedConsts: map[string]igop.UntypedConst{},
+	})
+}
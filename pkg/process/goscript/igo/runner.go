@@ -4,6 +4,7 @@ import (
 	"github.com/ztrade/base/common"
 	"github.com/ztrade/base/engine"
 	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
 	. "github.com/ztrade/ztrade/pkg/event"
 )
 
@@ -58,7 +59,24 @@ func (r *igoRunner) OnDepth(depth *Depth) (err error) {
 	return
 }
 
+func (r *igoRunner) OnOrder(update *OrderUpdate) (err error) {
+	if h, ok := r.impl.(OrderHandler); ok {
+		h.OnOrder(update)
+	}
+	return
+}
+
 func (r *igoRunner) OnEvent(e *Event) (err error) {
+	switch data := e.GetData().(type) {
+	case *OrderAmend:
+		if h, ok := r.impl.(OrderAmendHandler); ok {
+			h.OnOrderAmend(data)
+		}
+	case *HedgePosition:
+		if h, ok := r.impl.(HedgePositionHandler); ok {
+			h.OnHedgePosition(data)
+		}
+	}
 	return
 }
 
@@ -9,6 +9,7 @@ import (
 	"github.com/ztrade/base/common"
 	bengine "github.com/ztrade/base/engine"
 	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
 	. "github.com/ztrade/ztrade/pkg/event"
 	"github.com/ztrade/ztrade/pkg/process/goscript/engine"
 )
@@ -85,6 +86,22 @@ func (sp *StrategyPlugin) OnDepth(depth *Depth) (err error) {
 	sp.Runner.OnDepth(depth)
 	return
 }
+func (sp *StrategyPlugin) OnOrder(update *OrderUpdate) (err error) {
+	if h, ok := sp.Runner.(OrderHandler); ok {
+		h.OnOrder(update)
+	}
+	return
+}
 func (sp *StrategyPlugin) OnEvent(e *Event) (err error) {
+	switch data := e.GetData().(type) {
+	case *OrderAmend:
+		if h, ok := sp.Runner.(OrderAmendHandler); ok {
+			h.OnOrderAmend(data)
+		}
+	case *HedgePosition:
+		if h, ok := sp.Runner.(HedgePositionHandler); ok {
+			h.OnHedgePosition(data)
+		}
+	}
 	return
 }
@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"fmt"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// DefaultTypes events from exchange which will be replayed by default,
+	// orders are generated again by scripts
+	DefaultTypes = []string{EventCandle, EventTrade, EventPosition, EventBalance, EventDepth, EventTradeMarket}
+)
+
+// Replay re-emit events recorded in journal
+type Replay struct {
+	BaseProcesser
+	journal string
+	types   map[string]bool
+	closeCh chan bool
+}
+
+func NewReplay(journal string) *Replay {
+	r := new(Replay)
+	r.Name = "replay"
+	r.journal = journal
+	r.SetTypes(DefaultTypes...)
+	return r
+}
+
+// SetTypes set event types to replay
+func (r *Replay) SetTypes(types ...string) {
+	r.types = make(map[string]bool)
+	for _, v := range types {
+		r.types[v] = true
+	}
+}
+
+func (r *Replay) SetCloseCh(closeCh chan bool) {
+	r.closeCh = closeCh
+}
+
+func (r *Replay) Init(bus *Bus) (err error) {
+	r.BaseProcesser.Init(bus)
+	r.Subscribe(EventWatch, r.onEventWatch)
+	return
+}
+
+func (r *Replay) onEventWatch(e *Event) (err error) {
+	if e.Name != "replay" {
+		return
+	}
+	go r.emitEvents()
+	return
+}
+
+func (r *Replay) emitEvents() {
+	records, errCh := ReadJournal(r.journal)
+	var n int
+	for v := range records {
+		if !r.types[v.Data.Type] {
+			continue
+		}
+		e := NewEvent(v.Name, v.Data.Type, v.From, v.Data.Data, v.Data.Extra)
+		// keep the recorded time, clock of replay is driven by it
+		e.Time = v.Time
+		e.Symbol = v.Symbol
+		r.Bus.WaitEmpty()
+		r.Bus.Send(e)
+		n++
+	}
+	err := <-errCh
+	if err != nil {
+		err = fmt.Errorf("replay %s failed: %w", r.journal, err)
+		r.Bus.Send(NewErrorEvent(r.Name, err.Error(), err))
+	}
+	log.Infof("replay %s finished, %d events emitted", r.journal, n)
+	if r.closeCh != nil {
+		r.closeCh <- true
+	}
+}
@@ -0,0 +1,432 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ztrade/base/common"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// Risk risk manager, must be added before exchange to intercept orders
+type Risk struct {
+	BaseProcesser
+	symbol string
+	limits RiskLimits
+
+	balanceInit float64
+	balance     float64
+	pos         float64
+	posPrice    float64
+	price       float64
+
+	day        time.Time
+	dayBalance float64
+	orderTimes []time.Time
+	// opens open orders passed and not finished, their pending amounts count toward position
+	opens map[string]*openOrder
+
+	killed bool
+	mutex  sync.Mutex
+}
+
+func NewRisk(symbol string) *Risk {
+	r := new(Risk)
+	r.Name = "risk"
+	r.Symbol = symbol
+	r.symbol = symbol
+	r.limits = NewRiskLimits()
+	r.opens = make(map[string]*openOrder)
+	return r
+}
+
+// openOrder open order passed by risk
+type openOrder struct {
+	act TradeAction
+	// filled filled amount by order status, traded amount by trades
+	filled float64
+	traded float64
+}
+
+// done return the filled amount of order
+func (o *openOrder) done() float64 {
+	return math.Max(o.filled, o.traded)
+}
+
+// pending return the amount not filled of open orders of direction, except the order of id
+func (r *Risk) pending(long bool, id string) (amount float64) {
+	for k, v := range r.opens {
+		if k != id && v.act.Action.IsLong() == long {
+			amount += math.Max(0, v.act.Amount-v.done())
+		}
+	}
+	return
+}
+
+func (r *Risk) Init(bus *Bus) (err error) {
+	r.BaseProcesser.Init(bus)
+	r.Subscribe(EventOrder, r.onEventOrder)
+	r.Subscribe(EventRiskLimit, r.onEventRiskLimit)
+	r.Subscribe(EventBalanceInit, r.onEventBalanceInit)
+	r.Subscribe(EventBalance, r.onEventBalance)
+	r.Subscribe(EventPosition, r.onEventPosition)
+	r.Subscribe(EventCandle, r.onEventCandle)
+	r.Subscribe(EventTradeMarket, r.onEventTradeMarket)
+	r.Subscribe(EventOrderStatus, r.onEventOrderStatus)
+	r.Subscribe(EventTrade, r.onEventTrade)
+	return
+}
+
+// IsKilled return if kill switch is triggered
+func (r *Risk) IsKilled() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.killed
+}
+
+func (r *Risk) equity() float64 {
+	if r.pos == 0 || r.price == 0 {
+		return r.balance
+	}
+	return r.balance + r.pos*(r.price-r.posPrice)
+}
+
+func (r *Risk) limit() (limit RiskLimit) {
+	limit, _ = r.limits.Get(r.symbol)
+	return
+}
+
+// checkLost check the max lose ratio, return the reason if kill switch should be triggered
+func (r *Risk) checkLost() (reason string) {
+	if r.killed || r.balanceInit <= 0 {
+		return
+	}
+	limit := r.limit()
+	ratio := r.limits.GetLimitRatio(RiskLimit{Code: limit.Code, Lever: limit.Lever})
+	if ratio <= 0 {
+		return
+	}
+	lost := (r.balanceInit - r.equity()) / r.balanceInit
+	if lost >= ratio {
+		reason = fmt.Sprintf("lose ratio %f reach max lose ratio %f", lost, ratio)
+	}
+	return
+}
+
+func (r *Risk) updateDay() {
+	day := r.Now().Truncate(common.Day)
+	if day.Equal(r.day) {
+		return
+	}
+	r.day = day
+	r.dayBalance = r.equity()
+}
+
+// checkOrder check the order, amount of act may be shrinked
+func (r *Risk) checkOrder(act *TradeAction) (reason string) {
+	if r.killed {
+		return "kill switch triggered"
+	}
+	limit := r.limit()
+	// only open orders increase exposure
+	if !act.Action.IsOpen() {
+		return
+	}
+	r.updateDay()
+	if limit.MaxDailyLostRatio > 0 && r.dayBalance > 0 {
+		lost := (r.dayBalance - r.equity()) / r.dayBalance
+		if lost >= limit.MaxDailyLostRatio {
+			return fmt.Sprintf("daily lose ratio %f reach limit %f", lost, limit.MaxDailyLostRatio)
+		}
+	}
+	amount := act.Amount
+	long := act.Action.IsLong()
+	// pending open orders of the same direction will increase the position
+	hold := r.pending(long, act.ID)
+	if (r.pos > 0 && long) || (r.pos < 0 && !long) {
+		// order of the same side adds to current position, order of the other side reduces it first
+		hold += math.Abs(r.pos)
+	}
+	if limit.MaxPosition > 0 && hold+amount > limit.MaxPosition {
+		amount = limit.MaxPosition - hold
+	}
+	price := act.Price
+	if price == 0 {
+		price = r.price
+	}
+	equity := r.equity()
+	if limit.Lever > 0 && price > 0 && equity > 0 {
+		maxHold := limit.Lever * equity / price
+		if hold+amount > maxHold {
+			amount = maxHold - hold
+		}
+	}
+	if amount <= 0 {
+		return fmt.Sprintf("position %f reach limit, order amount: %f", hold, act.Amount)
+	}
+	if amount != act.Amount {
+		log.Warnf("risk shrink order %s amount from %f to %f", act.ID, act.Amount, amount)
+		act.Amount = amount
+	}
+	return
+}
+
+// checkRate check the number of new orders sent in the last minute
+func (r *Risk) checkRate() (reason string) {
+	limit := r.limit()
+	if limit.MaxOrdersPerMinute <= 0 {
+		return
+	}
+	now := r.Now()
+	var i int
+	for i = 0; i < len(r.orderTimes); i++ {
+		if now.Sub(r.orderTimes[i]) < time.Minute {
+			break
+		}
+	}
+	r.orderTimes = r.orderTimes[i:]
+	if len(r.orderTimes) >= limit.MaxOrdersPerMinute {
+		return fmt.Sprintf("orders per minute reach limit %d", limit.MaxOrdersPerMinute)
+	}
+	return
+}
+
+// checkAmend check the amended open order like a new order if its amount is increased,
+// the filled part is in position already, only the amount not filled is checked
+func (r *Risk) checkAmend(act *TradeAction) (reason string) {
+	if r.killed {
+		return "kill switch triggered"
+	}
+	old, ok := r.opens[act.ID]
+	if !ok {
+		return
+	}
+	if act.Amount <= old.act.Amount {
+		if act.Amount != 0 {
+			old.act.Amount = act.Amount
+		}
+		return
+	}
+	filled := old.done()
+	amended := old.act
+	amended.Amount = act.Amount - filled
+	if act.Price != 0 {
+		amended.Price = act.Price
+	}
+	reason = r.checkOrder(&amended)
+	if reason != "" {
+		return
+	}
+	act.Amount = amended.Amount + filled
+	old.act.Amount, old.act.Price = act.Amount, amended.Price
+	return
+}
+
+func (r *Risk) onEventOrder(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	act, ok := e.GetData().(*TradeAction)
+	if !ok {
+		log.Errorf("risk onEventOrder type error: %##v", e.GetData())
+		return
+	}
+	var reason string
+	r.mutex.Lock()
+	switch act.Action {
+	case CancelAll:
+		r.opens = make(map[string]*openOrder)
+	case CancelOne:
+		delete(r.opens, act.ID)
+	case AmendOne:
+		reason = r.checkAmend(act)
+	default:
+		reason = r.checkOrder(act)
+		if reason == "" {
+			reason = r.checkRate()
+		}
+		if reason != "" {
+			break
+		}
+		// only new orders passed all checks are counted
+		if r.limit().MaxOrdersPerMinute > 0 {
+			r.orderTimes = append(r.orderTimes, r.Now())
+		}
+		if act.Action.IsOpen() {
+			r.opens[act.ID] = &openOrder{act: *act}
+		}
+	}
+	r.mutex.Unlock()
+	if reason == "" {
+		return
+	}
+	log.Warnf("risk reject order %#v: %s", *act, reason)
+	r.Send(act.ID, EventOrderReject, &OrderReject{Action: *act, Reason: reason})
+	r.Send(act.ID, EventOrderStatus, &OrderUpdate{Action: *act, Status: OrderRejected, Reason: reason, Time: r.Now()})
+	return ErrStopPropagation
+}
+
+// onEventOrderStatus update the filled amount of open order, finished orders are removed
+func (r *Risk) onEventOrderStatus(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	update, ok := e.GetData().(*OrderUpdate)
+	if !ok {
+		log.Errorf("risk onEventOrderStatus type error: %##v", e.GetData())
+		return
+	}
+	r.mutex.Lock()
+	if o, ok := r.opens[update.Action.ID]; ok {
+		if update.Status.IsFinal() {
+			delete(r.opens, update.Action.ID)
+		} else {
+			o.filled = math.Max(o.filled, update.Filled)
+		}
+	}
+	r.mutex.Unlock()
+	return
+}
+
+// onEventTrade update the filled amount of open order by its trades
+func (r *Risk) onEventTrade(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	tr, ok := e.GetData().(*Trade)
+	if !ok {
+		log.Errorf("risk onEventTrade type error: %##v", e.GetData())
+		return
+	}
+	r.mutex.Lock()
+	if o, ok := r.opens[tr.ID]; ok {
+		o.traded += tr.Amount
+		if o.done() >= o.act.Amount {
+			delete(r.opens, tr.ID)
+		}
+	}
+	r.mutex.Unlock()
+	return
+}
+
+func (r *Risk) onEventRiskLimit(e *Event) (err error) {
+	limit, ok := e.GetData().(*RiskLimit)
+	if !ok {
+		log.Errorf("risk onEventRiskLimit type error: %##v", e.GetData())
+		return
+	}
+	r.mutex.Lock()
+	r.limits.Update(*limit)
+	r.mutex.Unlock()
+	return
+}
+
+func (r *Risk) onEventBalanceInit(e *Event) (err error) {
+	balance, ok := e.GetData().(*BalanceInfo)
+	if !ok {
+		log.Errorf("risk onEventBalanceInit type error: %##v", e.GetData())
+		return
+	}
+	r.mutex.Lock()
+	r.balanceInit = balance.Balance
+	r.balance = balance.Balance
+	r.mutex.Unlock()
+	return
+}
+
+func (r *Risk) onEventBalance(e *Event) (err error) {
+	balance, ok := e.GetData().(*Balance)
+	if !ok {
+		log.Errorf("risk onEventBalance type error: %##v", e.GetData())
+		return
+	}
+	r.mutex.Lock()
+	r.balance = balance.Balance
+	if r.balanceInit == 0 {
+		r.balanceInit = balance.Balance
+	}
+	reason := r.checkLost()
+	r.mutex.Unlock()
+	r.kill(reason)
+	return
+}
+
+func (r *Risk) onEventPosition(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	pos, ok := e.GetData().(*Position)
+	if !ok {
+		log.Errorf("risk onEventPosition type error: %##v", e.GetData())
+		return
+	}
+	if r.symbol != "" && pos.Symbol != "" && pos.Symbol != r.symbol {
+		return
+	}
+	r.mutex.Lock()
+	r.pos = pos.Hold
+	r.posPrice = pos.Price
+	reason := r.checkLost()
+	r.mutex.Unlock()
+	r.kill(reason)
+	return
+}
+
+func (r *Risk) onEventCandle(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	candle, ok := e.GetData().(*Candle)
+	if !ok {
+		log.Errorf("risk onEventCandle type error: %##v", e.GetData())
+		return
+	}
+	r.updatePrice(candle.Close)
+	return
+}
+
+func (r *Risk) onEventTradeMarket(e *Event) (err error) {
+	if !r.MatchSymbol(e) {
+		return
+	}
+	trade, ok := e.GetData().(*Trade)
+	if !ok {
+		log.Errorf("risk onEventTradeMarket type error: %##v", e.GetData())
+		return
+	}
+	r.updatePrice(trade.Price)
+	return
+}
+
+func (r *Risk) updatePrice(price float64) {
+	r.mutex.Lock()
+	r.price = price
+	r.updateDay()
+	reason := r.checkLost()
+	r.mutex.Unlock()
+	r.kill(reason)
+}
+
+// kill cancel all orders and halt the scripts
+func (r *Risk) kill(reason string) {
+	if reason == "" {
+		return
+	}
+	r.mutex.Lock()
+	if r.killed {
+		r.mutex.Unlock()
+		return
+	}
+	r.killed = true
+	r.mutex.Unlock()
+	log.Errorf("risk kill switch triggered: %s", reason)
+	r.Send(EventOrder, EventOrder, &TradeAction{Action: CancelAll, Symbol: r.symbol})
+	r.Send(r.symbol, EventKillSwitch, &KillSwitch{Reason: reason})
+	r.Send("notify", EventNotify, &NotifyEvent{Type: "text", Title: "Kill switch", Content: reason})
+}
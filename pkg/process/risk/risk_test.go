@@ -0,0 +1,130 @@
+package risk
+
+import (
+	"testing"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+)
+
+type recorder struct {
+	BaseProcesser
+	orders  []TradeAction
+	rejects []OrderReject
+	kills   []KillSwitch
+}
+
+func (r *recorder) Init(bus *Bus) (err error) {
+	r.BaseProcesser.Init(bus)
+	r.Subscribe(EventOrder, func(e *Event) error {
+		r.orders = append(r.orders, *e.GetData().(*TradeAction))
+		return nil
+	})
+	r.Subscribe(EventOrderReject, func(e *Event) error {
+		r.rejects = append(r.rejects, *e.GetData().(*OrderReject))
+		return nil
+	})
+	r.Subscribe(EventKillSwitch, func(e *Event) error {
+		r.kills = append(r.kills, *e.GetData().(*KillSwitch))
+		return nil
+	})
+	return
+}
+
+func newTestRisk(t *testing.T, limit RiskLimit) (param *BaseProcesser, r *Risk, rec *recorder) {
+	param = NewBaseProcesser("param")
+	r = NewRisk("BTCUSDT")
+	rec = &recorder{BaseProcesser: BaseProcesser{Name: "recorder"}}
+	procs := NewSyncProcessers()
+	procs.Adds(param, r, rec)
+	err := procs.Start()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	param.Send("risk_init", EventRiskLimit, &limit)
+	param.SendWithExtra("candle", EventCandle, &Candle{Start: 1600000000, Close: 100}, "1m")
+	return
+}
+
+func TestRiskShrinkAndReject(t *testing.T) {
+	param, _, rec := newTestRisk(t, RiskLimit{Lever: 1, MaxPosition: 5, MaxOrdersPerMinute: 3})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 8})
+	if len(rec.orders) != 1 || rec.orders[0].Amount != 5 {
+		t.Fatalf("order should be shrinked to max position: %#v", rec.orders)
+	}
+	param.Send("BTCUSDT", EventPosition, &Position{Symbol: "BTCUSDT", Hold: 5, Price: 100})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 100, Amount: 1})
+	if len(rec.orders) != 1 || len(rec.rejects) != 1 {
+		t.Fatalf("order should be rejected by max position: %#v %#v", rec.orders, rec.rejects)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: CloseLong, Price: 110, Amount: 5})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: CancelOne})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "4", Action: CloseLong, Price: 110, Amount: 5})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "5", Action: CloseLong, Price: 110, Amount: 5})
+	if len(rec.orders) != 4 || len(rec.rejects) != 2 || rec.rejects[1].Action.ID != "5" {
+		t.Fatalf("rejected orders and cancels should not be counted in orders per minute: %#v %#v", rec.orders, rec.rejects)
+	}
+}
+
+func TestRiskKillSwitch(t *testing.T) {
+	param, r, rec := newTestRisk(t, RiskLimit{Lever: 1, MaxLostRatio: 0.1})
+	param.Send("BTCUSDT", EventPosition, &Position{Symbol: "BTCUSDT", Hold: 10, Price: 100})
+	param.SendWithExtra("candle", EventCandle, &Candle{Start: 1600000060, Close: 95}, "1m")
+	if r.IsKilled() {
+		t.Fatal("kill switch should not be triggered")
+	}
+	param.SendWithExtra("candle", EventCandle, &Candle{Start: 1600000120, Close: 89}, "1m")
+	if !r.IsKilled() || len(rec.kills) != 1 {
+		t.Fatal("kill switch should be triggered")
+	}
+	if len(rec.orders) != 1 || rec.orders[0].Action != CancelAll {
+		t.Fatalf("kill switch should cancel all orders: %#v", rec.orders)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: CloseLong, Price: 90, Amount: 10})
+	if len(rec.orders) != 1 || len(rec.rejects) != 1 {
+		t.Fatalf("order should be rejected after kill switch: %#v", rec.orders)
+	}
+}
+
+func TestRiskAmend(t *testing.T) {
+	param, _, rec := newTestRisk(t, RiskLimit{Lever: 1, MaxPosition: 5})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 3})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Amount: 8})
+	if len(rec.orders) != 2 || rec.orders[1].Amount != 5 {
+		t.Fatalf("amended amount should be shrinked to max position: %#v", rec.orders)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Amount: 2})
+	if len(rec.orders) != 3 || rec.orders[2].Amount != 2 {
+		t.Fatalf("amended amount should not be checked if reduced: %#v", rec.orders)
+	}
+}
+
+func TestRiskPendingOrders(t *testing.T) {
+	param, _, rec := newTestRisk(t, RiskLimit{Lever: 1, MaxPosition: 5})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 3})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 100, Amount: 3})
+	if len(rec.orders) != 2 || rec.orders[1].Amount != 2 {
+		t.Fatalf("pending open orders should count toward max position: %#v", rec.orders)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: OpenShort, Price: 100, Amount: 3})
+	if len(rec.orders) != 3 || rec.orders[2].Amount != 3 {
+		t.Fatalf("pending orders of the other direction should not count: %#v", rec.orders)
+	}
+	// order 1 filled 2 and canceled, order 2 filled in full
+	param.Send("1", EventTrade, &Trade{ID: "1", Action: OpenLong, Price: 100, Amount: 2})
+	param.Send("1", EventOrderStatus, &OrderUpdate{Action: TradeAction{ID: "1", Action: OpenLong, Amount: 3}, Status: OrderCanceled, Filled: 2})
+	param.Send("2", EventTrade, &Trade{ID: "2", Action: OpenLong, Price: 100, Amount: 2})
+	param.Send("BTCUSDT", EventPosition, &Position{Symbol: "BTCUSDT", Hold: 4, Price: 100})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "4", Action: OpenLong, Price: 100, Amount: 3})
+	if len(rec.orders) != 4 || rec.orders[3].Amount != 1 {
+		t.Fatalf("finished orders should not count: %#v", rec.orders)
+	}
+	param.Send("4", EventOrderStatus, &OrderUpdate{Action: TradeAction{ID: "4", Action: OpenLong, Amount: 1}, Status: OrderPartiallyFilled, Filled: 0.5})
+	param.Send("BTCUSDT", EventPosition, &Position{Symbol: "BTCUSDT", Hold: 4.5, Price: 100})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "4", Action: AmendOne, Amount: 3})
+	if len(rec.orders) != 5 || rec.orders[4].Amount != 1 {
+		t.Fatalf("amended order should be checked with the amount not filled: %#v", rec.orders)
+	}
+}
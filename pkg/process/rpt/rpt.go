@@ -17,6 +17,31 @@ type Reporter interface {
 	SetLever(float64)
 }
 
+// FundingReporter reporter which records funding payments
+type FundingReporter interface {
+	OnFunding(Funding)
+}
+
+// SpotReporter reporter which supports trades of spot account
+type SpotReporter interface {
+	SetSpot(bool)
+}
+
+// HedgeReporter reporter which attributes profits to long and short legs of hedge mode
+type HedgeReporter interface {
+	SetHedge(bool)
+}
+
+// FeeReporter reporter which replays trades with maker and taker fee rates
+type FeeReporter interface {
+	SetFees(*FeeSchedule)
+}
+
+// SymbolReporter reporter which breaks down trades by symbol
+type SymbolReporter interface {
+	OnSymbolTrade(symbol string, t Trade)
+}
+
 type Rpt struct {
 	BaseProcesser
 	rpt Reporter
@@ -33,6 +58,7 @@ func (rpt *Rpt) Init(bus *Bus) (err error) {
 	rpt.Subscribe(EventTrade, rpt.OnEventTrade)
 	rpt.Subscribe(EventBalanceInit, rpt.OnEventBalanceInit)
 	rpt.Subscribe(EventRiskLimit, rpt.OnEventRiskLimit)
+	rpt.Subscribe(EventFunding, rpt.OnEventFunding)
 	return
 }
 
@@ -51,8 +77,32 @@ func (rpt *Rpt) OnEventTrade(e *Event) (err error) {
 		log.Error(err.Error())
 		return
 	}
-	if rpt.rpt != nil {
-		rpt.rpt.OnTrade(*t)
+	// trade without time is stamped with the time of event
+	if t.Time.IsZero() {
+		t.Time = e.GetTime()
+	}
+	if rpt.rpt == nil {
+		return
+	}
+	sr, ok := rpt.rpt.(SymbolReporter)
+	if ok && e.Symbol != "" {
+		sr.OnSymbolTrade(e.Symbol, *t)
+		return
+	}
+	rpt.rpt.OnTrade(*t)
+	return
+}
+
+func (rpt *Rpt) OnEventFunding(e *Event) (err error) {
+	f := e.GetData().(*Funding)
+	if f == nil {
+		err = fmt.Errorf("rpt OnEventFunding type error:%#v", e.GetData())
+		log.Error(err.Error())
+		return
+	}
+	fr, ok := rpt.rpt.(FundingReporter)
+	if ok {
+		fr.OnFunding(*f)
 	}
 	return
 }
@@ -66,6 +116,9 @@ func (rpt *Rpt) OnEventBalanceInit(e *Event) (err error) {
 	}
 	if rpt.rpt != nil {
 		rpt.rpt.OnBalanceInit(balance.Balance, balance.Fee)
+		if fr, ok := rpt.rpt.(FeeReporter); ok && balance.Fees != nil {
+			fr.SetFees(balance.Fees)
+		}
 	}
 	return
 }
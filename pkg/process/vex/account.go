@@ -0,0 +1,86 @@
+package vex
+
+import (
+	"math"
+	"sync"
+
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// Account margin balance shared by VExchanges of different symbols,
+// every VExchange keeps its own position and reports its profit and used margin to account
+type Account struct {
+	balance float64
+	profits map[string]float64
+	margins map[string]float64
+	mutex   sync.Mutex
+}
+
+func NewAccount() *Account {
+	a := new(Account)
+	a.profits = make(map[string]float64)
+	a.margins = make(map[string]float64)
+	return a
+}
+
+func (a *Account) setBalance(balance float64) {
+	a.mutex.Lock()
+	a.balance = balance
+	a.mutex.Unlock()
+}
+
+// update set the profit with fees and funding and the margin used by position of symbol
+func (a *Account) update(symbol string, profit, margin float64) {
+	a.mutex.Lock()
+	a.profits[symbol] = profit
+	a.margins[symbol] = margin
+	a.mutex.Unlock()
+}
+
+// Total balance with profits of all symbols
+func (a *Account) Total() (total float64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	total = a.balance
+	for _, v := range a.profits {
+		total += v
+	}
+	return
+}
+
+// available return the balance which is not used by positions of other symbols
+func (a *Account) available(symbol string) (balance float64) {
+	balance = a.Total()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for k, v := range a.margins {
+		if k != symbol {
+			balance -= v
+		}
+	}
+	return
+}
+
+// SetAccount share margin balance with VExchanges of other symbols
+func (ex *VExchange) SetAccount(account *Account) {
+	ex.account = account
+}
+
+// margin return the margin used by position
+func (ex *VExchange) margin() float64 {
+	if hb, ok := ex.balance.(*HedgeBalance); ok {
+		return hb.Margin()
+	}
+	if ex.lever <= 0 {
+		return 0
+	}
+	return math.Abs(ex.position) * ex.entryPrice / ex.lever
+}
+
+// syncAccount report profit and margin to account
+func (ex *VExchange) syncAccount() {
+	if ex.account == nil {
+		return
+	}
+	ex.account.update(ex.symbol, ex.balance.Get()-ex.balanceInit, ex.margin())
+}
@@ -0,0 +1,280 @@
+package vex
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+)
+
+// book order book of VExchange, sells are sorted by price asc and buys by price desc
+type book struct {
+	sells []DepthInfo
+	buys  []DepthInfo
+}
+
+func newBook(depth *Depth) (b book) {
+	b.sells = append([]DepthInfo{}, depth.Sells...)
+	b.buys = append([]DepthInfo{}, depth.Buys...)
+	sort.Slice(b.sells, func(i, j int) bool {
+		return b.sells[i].Price < b.sells[j].Price
+	})
+	sort.Slice(b.buys, func(i, j int) bool {
+		return b.buys[i].Price > b.buys[j].Price
+	})
+	return
+}
+
+// vwap return the average price to take amount from book
+// buy takes sells of book, limit 0 means no limit price
+// the amount left after the levels within limit are taken is filled at limit
+func (b *book) vwap(buy bool, amount, limit float64) (price float64, ok bool) {
+	levels := b.buys
+	if buy {
+		levels = b.sells
+	}
+	if len(levels) == 0 || amount <= 0 {
+		return
+	}
+	var left, total, last = amount, 0.0, 0.0
+	for _, v := range levels {
+		if limit != 0 && ((buy && v.Price > limit) || (!buy && v.Price < limit)) {
+			break
+		}
+		n := v.Amount
+		if n > left {
+			n = left
+		}
+		total += n * v.Price
+		left -= n
+		last = v.Price
+		if left <= 0 {
+			break
+		}
+	}
+	if left > 0 {
+		if limit != 0 {
+			last = limit
+		} else if last == 0 {
+			last = levels[0].Price
+		}
+		total += left * last
+	}
+	return total / amount, true
+}
+
+// amountWithin return the amount of levels within limit which can be taken
+func (b *book) amountWithin(buy bool, limit float64) (amount float64) {
+	levels := b.buys
+	if buy {
+		levels = b.sells
+	}
+	for _, v := range levels {
+		if (buy && v.Price > limit) || (!buy && v.Price < limit) {
+			break
+		}
+		amount += v.Amount
+	}
+	return
+}
+
+// crossed return true if the limit order can take liquidity from book
+func (b *book) crossed(o *order) bool {
+	if o.Action.IsLong() {
+		return len(b.sells) > 0 && o.Price >= b.sells[0].Price
+	}
+	return len(b.buys) > 0 && o.Price <= b.buys[0].Price
+}
+
+// amountAt return the resting amount at price on the side of order
+func (b *book) amountAt(o *order) float64 {
+	levels := b.sells
+	if o.Action.IsLong() {
+		levels = b.buys
+	}
+	for _, v := range levels {
+		if v.Price == o.Price {
+			return v.Amount
+		}
+	}
+	return 0
+}
+
+// SetBookMode match limit orders with depth snapshots and market trades instead of price path,
+// stop and market orders take the liquidity of book, book mode works with tick mode
+func (ex *VExchange) SetBookMode(bookMode bool) {
+	ex.bookMode = bookMode
+	if bookMode {
+		ex.tickMode = true
+	}
+}
+
+func (ex *VExchange) onEventDepth(e *Event) (err error) {
+	if !ex.bookMode || !ex.MatchSymbol(e) {
+		return
+	}
+	depth, ok := e.GetData().(*Depth)
+	if !ok {
+		err = fmt.Errorf("VExchange depth type error:%s", reflect.TypeOf(e.GetData()))
+		return
+	}
+	tm := depth.UpdateTime
+	if tm.IsZero() {
+		tm = ex.Now()
+	}
+	ex.orderMutex.Lock()
+	ex.book = newBook(depth)
+	events, err := ex.arriveOrders(tm)
+	if err != nil {
+		ex.orderMutex.Unlock()
+		return
+	}
+	var took []*order
+	matched, err := ex.matchBook(tm, func(o *order) (price, amount float64, ok bool) {
+		if !ex.book.crossed(o) {
+			// orders ahead can be canceled but never grow
+			n := ex.book.amountAt(o)
+			if !o.queued || n < o.queue {
+				o.queue = n
+				o.queued = true
+			}
+			return
+		}
+		if !o.taker {
+			// resting order is traded through by the new snapshot, it is filled at its price
+			return o.Price, o.remain(), true
+		}
+		// order crossing on arrival takes the levels within limit price, the rest keeps resting
+		took = append(took, o)
+		buy := o.Action.IsLong()
+		amount = math.Min(o.remain(), ex.book.amountWithin(buy, o.Price))
+		if amount <= amountEpsilon {
+			return
+		}
+		price, ok = ex.book.vwap(buy, amount, o.Price)
+		return
+	})
+	for _, o := range took {
+		o.taker = false
+	}
+	events = append(events, matched...)
+	events = append(events, ex.takeUpdates()...)
+	ex.orderMutex.Unlock()
+	for _, e := range events {
+		ex.Bus.Send(e)
+	}
+	return
+}
+
+// processBookTrade match limit orders with market trade
+// the order is filled when the trade is through its price or the queue ahead is consumed
+func (ex *VExchange) processBookTrade(trade *Trade) (err error) {
+	ex.orderMutex.Lock()
+	events, err := ex.arriveOrders(trade.Time)
+	if err != nil {
+		ex.orderMutex.Unlock()
+		return
+	}
+	matched, err := ex.matchBook(trade.Time, func(o *order) (price, amount float64, ok bool) {
+		if (o.Action.IsLong() && trade.Price < o.Price) || (!o.Action.IsLong() && trade.Price > o.Price) {
+			return o.Price, o.remain(), true
+		}
+		if trade.Price != o.Price {
+			return
+		}
+		o.queue -= trade.Amount
+		o.queued = true
+		if o.queue >= 0 {
+			return
+		}
+		// the order is at the front of queue, only the amount traded beyond the queue is filled
+		amount = math.Min(-o.queue, o.remain())
+		o.queue = 0
+		return o.Price, amount, true
+	})
+	events = append(events, matched...)
+	events = append(events, ex.takeUpdates()...)
+	ex.orderMutex.Unlock()
+	for _, e := range events {
+		ex.Bus.Send(e)
+	}
+	return
+}
+
+// matchImmediate fill IOC or FOK limit order with book at once, the rest is canceled
+func (ex *VExchange) matchImmediate(o *order, tm time.Time) (events []*Event, err error) {
+	defer func() {
+		if o.remain() > amountEpsilon {
+			ex.orderUpdate(o, OrderCanceled, "not filled immediately")
+		}
+	}()
+	if !ex.book.crossed(o) {
+		return
+	}
+	buy := o.Action.IsLong()
+	amount := math.Min(o.remain(), ex.book.amountWithin(buy, o.Price))
+	if o.opt.TimeInForce == FOK && amount < o.remain()-amountEpsilon {
+		return
+	}
+	price, ok := ex.book.vwap(buy, amount, o.Price)
+	if !ok {
+		return
+	}
+	side := "sell"
+	if buy {
+		side = "buy"
+	}
+	tr, err := ex.fillOrder(o, price, amount, side, tm)
+	if err != nil || tr == nil {
+		return
+	}
+	events = append(events, ex.CreateEvent("trade", EventTrade, tr))
+	events = append(events, ex.positionEvents(tr.Price)...)
+	return
+}
+
+// matchBook fill limit orders which match returns ok with the price and amount to fill
+func (ex *VExchange) matchBook(tm time.Time, match func(o *order) (price, amount float64, ok bool)) (events []*Event, err error) {
+	ex.expireOrders(tm)
+	var next *list.Element
+	var posPrice float64
+	var tr *Trade
+	for elem := ex.orders.Front(); elem != nil; elem = next {
+		next = elem.Next()
+		o, ok := elem.Value.(*order)
+		if !ok || !o.isLimit() || o.remain() <= amountEpsilon {
+			continue
+		}
+		price, amount, ok := match(o)
+		if !ok {
+			continue
+		}
+		side := "sell"
+		if o.Action.IsLong() {
+			side = "buy"
+		}
+		tr, err = ex.fillOrder(o, price, amount, side, tm)
+		if err != nil {
+			return
+		}
+		if tr == nil {
+			continue
+		}
+		events = append(events, ex.CreateEvent("trade", EventTrade, tr))
+		posPrice = tr.Price
+		if o.done() {
+			ex.orders.Remove(elem)
+		}
+	}
+	ex.updateGroups()
+	if posPrice != 0 {
+		events = append(events, ex.positionEvents(posPrice)...)
+	}
+	return
+}
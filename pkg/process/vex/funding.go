@@ -0,0 +1,126 @@
+package vex
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ztrade/base/common"
+	. "github.com/ztrade/ztrade/pkg/core"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// SetFunding settle funding of position every interval, funding is disabled if interval is zero
+// the latest rate before the funding time is used
+func (ex *VExchange) SetFunding(interval time.Duration, rates []*FundingRate) {
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Start < rates[j].Start
+	})
+	ex.fundingInterval = interval
+	ex.fundingRates = rates
+	ex.fundingIndex = 0
+}
+
+// fundingRate return the latest funding rate before t
+func (ex *VExchange) fundingRate(t time.Time) (rate *FundingRate) {
+	for ex.fundingIndex < len(ex.fundingRates) && ex.fundingRates[ex.fundingIndex].Start <= t.Unix() {
+		ex.fundingIndex++
+	}
+	if ex.fundingIndex == 0 {
+		return
+	}
+	rate = ex.fundingRates[ex.fundingIndex-1]
+	return
+}
+
+// processFunding settle funding on each funding time before the candle
+// funding is not settled in spot mode
+func (ex *VExchange) processFunding(candle Candle) {
+	if ex.fundingInterval <= 0 || ex.spot {
+		return
+	}
+	tm := candle.Time()
+	if ex.nextFunding.IsZero() {
+		ex.nextFunding = tm.Truncate(ex.fundingInterval).Add(ex.fundingInterval)
+		return
+	}
+	for !ex.nextFunding.After(tm) {
+		fundingTime := ex.nextFunding
+		ex.nextFunding = ex.nextFunding.Add(ex.fundingInterval)
+		rate := ex.fundingRate(fundingTime)
+		if ex.position == 0 || rate == nil {
+			continue
+		}
+		price := rate.MarkPrice
+		if price == 0 {
+			price = candle.Open
+		}
+		// long pays short when rate is positive
+		amount := -ex.position * price * rate.Rate
+		if fb, ok := ex.balance.(fundingBalancer); ok {
+			fb.AddFunding(amount)
+		}
+		ex.posFunding += amount
+		ex.syncAccount()
+		log.Debugf("vexchange funding %s rate: %f, position: %f, amount: %f", fundingTime, rate.Rate, ex.position, amount)
+		ex.Send(ex.symbol, EventFunding, &Funding{Symbol: ex.symbol, Time: fundingTime, Rate: rate.Rate, Price: price, Hold: ex.position, Amount: amount})
+		ex.Send(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.totalBalance()})
+	}
+}
+
+// fundingBalancer balancer which funding payments can be applied to
+type fundingBalancer interface {
+	AddFunding(amount float64)
+}
+
+// leverBalance common.LeverBalance with funding payments,
+// funding is included in balance so it's checked when open orders
+type leverBalance struct {
+	*common.LeverBalance
+	lever   float64
+	fee     float64
+	funding float64
+}
+
+func newLeverBalance() *leverBalance {
+	return &leverBalance{LeverBalance: common.NewLeverBalance(), lever: 1, fee: 0.00075}
+}
+
+func (b *leverBalance) Set(total float64) {
+	b.funding = 0
+	b.LeverBalance.Set(total)
+}
+
+func (b *leverBalance) SetFee(fee float64) {
+	b.fee = fee
+	b.LeverBalance.SetFee(fee)
+}
+
+func (b *leverBalance) SetLever(lever float64) {
+	b.lever = lever
+	b.LeverBalance.SetLever(lever)
+}
+
+// Get return the balance with funding payments
+func (b *leverBalance) Get() float64 {
+	return b.LeverBalance.Get() + b.funding
+}
+
+func (b *leverBalance) AddFunding(amount float64) {
+	b.funding += amount
+}
+
+func (b *leverBalance) AddTrade(tr Trade) (profit, onceFee float64, err error) {
+	if tr.Action.IsOpen() && b.funding < 0 && b.lever > 0 {
+		cost := tr.Amount * tr.Price
+		if cost < 0 {
+			cost = -cost
+		}
+		if b.Get() < cost/b.lever+cost*b.fee {
+			err = common.ErrNoBalance
+			return
+		}
+	}
+	return b.LeverBalance.AddTrade(tr)
+}
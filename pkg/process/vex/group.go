@@ -0,0 +1,76 @@
+package vex
+
+import (
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// addGroupLeg link order to its group, the group is created by its first leg
+func (ex *VExchange) addGroupLeg(o *order) {
+	g, ok := ex.groups[o.opt.GroupID]
+	if !ok {
+		g = NewOrderGroup(o.opt.GroupID, o.opt.ParentID)
+		if g.Parent != "" {
+			parent := ex.findOrder(g.Parent)
+			if parent != nil {
+				g.Fill(parent.ID, parent.filled)
+			} else {
+				log.Warnf("VExchange parent order %s of group not found", g.Parent)
+				g.SetParentDone()
+			}
+		}
+		ex.groups[g.ID] = g
+	}
+	g.AddLeg(o.ID, o.Amount)
+	o.group = g
+}
+
+// findOrder return the working order with id
+func (ex *VExchange) findOrder(id string) *order {
+	for elem := ex.orders.Front(); elem != nil; elem = elem.Next() {
+		o, ok := elem.Value.(*order)
+		if ok && o.ID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+// fillGroups record the filled amount of parent or leg to groups
+func (ex *VExchange) fillGroups(id string, amount float64) {
+	for _, g := range ex.groups {
+		g.Fill(id, amount)
+	}
+}
+
+// updateGroups cancel the legs of finished groups,
+// the parent not working any more is filled in full or canceled
+func (ex *VExchange) updateGroups() {
+	if len(ex.groups) == 0 {
+		return
+	}
+	working := make(map[string]bool)
+	for elem := ex.orders.Front(); elem != nil; elem = elem.Next() {
+		o, ok := elem.Value.(*order)
+		if ok {
+			working[o.ID] = true
+		}
+	}
+	for id, g := range ex.groups {
+		if g.Parent != "" && !working[g.Parent] {
+			g.SetParentDone()
+		}
+		for _, leg := range g.Legs() {
+			if !working[leg] {
+				g.RemoveLeg(leg)
+			}
+		}
+		if len(g.Legs()) != 0 && !g.Done() {
+			continue
+		}
+		ex.removeOrders(OrderCanceled, "linked order group finished", func(o *order) bool {
+			return o.group == g
+		})
+		delete(ex.groups, id)
+	}
+}
@@ -0,0 +1,139 @@
+package vex
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+)
+
+// Latency delay between sending order action and exchange receiving it
+type Latency interface {
+	Delay() time.Duration
+}
+
+// NewLatency create latency model of order actions
+// typ: none,fixed,uniform,normal
+// fixed: every action is delayed by value
+// uniform: delay is uniform in [value-jitter, value+jitter]
+// normal: delay is normal with mean value and standard deviation jitter
+// random delays use fixed seed, so backtests are repeatable
+func NewLatency(typ string, value, jitter time.Duration) (l Latency, err error) {
+	if value < 0 || jitter < 0 {
+		err = fmt.Errorf("latency can't be negative: %s %s", value, jitter)
+		return
+	}
+	rnd := rand.New(rand.NewSource(1))
+	switch typ {
+	case "", "none":
+		l = NoLatency{}
+	case "fixed":
+		l = FixedLatency{Value: value}
+	case "uniform":
+		l = &UniformLatency{Value: value, Jitter: jitter, rnd: rnd}
+	case "normal":
+		l = &NormalLatency{Mean: value, StdDev: jitter, rnd: rnd}
+	default:
+		err = fmt.Errorf("unsupport latency type: %s", typ)
+	}
+	return
+}
+
+// NoLatency action arrives at once
+type NoLatency struct{}
+
+func (l NoLatency) Delay() time.Duration {
+	return 0
+}
+
+// FixedLatency action arrives after fixed delay
+type FixedLatency struct {
+	Value time.Duration
+}
+
+func (l FixedLatency) Delay() time.Duration {
+	return l.Value
+}
+
+// UniformLatency delay is uniform around value
+type UniformLatency struct {
+	Value  time.Duration
+	Jitter time.Duration
+	rnd    *rand.Rand
+}
+
+func (l *UniformLatency) Delay() time.Duration {
+	if l.Jitter == 0 {
+		return l.Value
+	}
+	d := l.Value - l.Jitter + time.Duration(l.rnd.Int63n(int64(2*l.Jitter)+1))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// NormalLatency delay is normal distribution, negative delays are treated as 0
+type NormalLatency struct {
+	Mean   time.Duration
+	StdDev time.Duration
+	rnd    *rand.Rand
+}
+
+func (l *NormalLatency) Delay() time.Duration {
+	d := l.Mean + time.Duration(l.rnd.NormFloat64()*float64(l.StdDev))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// inflight order action sent but not arrived at exchange
+type inflight struct {
+	act TradeAction
+	opt OrderOption
+	at  time.Time
+}
+
+// SetLatency delay orders, cancels and amends by latency model,
+// actions arrive in the order they are sent, and take effect when the time of candle,
+// market trade or depth reaches their arrival, so in candle mode they wait for the next candle
+func (ex *VExchange) SetLatency(latency Latency) {
+	if latency == nil {
+		latency = NoLatency{}
+	}
+	ex.latency = latency
+}
+
+// sendOrder send order action to exchange, returns false if it's in flight
+func (ex *VExchange) sendOrder(act *TradeAction, opt OrderOption) bool {
+	delay := ex.latency.Delay()
+	if delay <= 0 && len(ex.inflights) == 0 {
+		return true
+	}
+	at := ex.Now().Add(delay)
+	if n := len(ex.inflights); n > 0 && at.Before(ex.inflights[n-1].at) {
+		at = ex.inflights[n-1].at
+	}
+	ex.inflights = append(ex.inflights, inflight{act: *act, opt: opt, at: at})
+	return false
+}
+
+// arriveOrders process the actions arrived before tm
+func (ex *VExchange) arriveOrders(tm time.Time) (events []*Event, err error) {
+	var evts []*Event
+	for len(ex.inflights) > 0 && !ex.inflights[0].at.After(tm) {
+		v := ex.inflights[0]
+		ex.inflights = ex.inflights[1:]
+		evts, err = ex.addOrder(&v.act, v.opt, v.at)
+		if err != nil {
+			return
+		}
+		events = append(events, evts...)
+	}
+	ex.updateGroups()
+	return
+}
@@ -0,0 +1,79 @@
+package vex
+
+import (
+	"math"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+)
+
+// amountEpsilon order is treated as filled if the remain amount is less than it
+const amountEpsilon = 1e-9
+
+// order pending order of VExchange
+type order struct {
+	TradeAction
+	// marketable limit order is filled at the first price of path like market order,
+	// otherwise limit order is filled at its price
+	marketable bool
+	// queue estimated amount ahead of the order at its price level in book mode
+	queue  float64
+	queued bool
+	// filled amount of partially filled order
+	filled float64
+	opt    OrderOption
+	// group linked order group of leg
+	group *OrderGroup
+	// best price since trailing stop placed
+	best float64
+	// triggered stop order which is partially filled, the rest is filled like market order
+	triggered bool
+	// taker order takes liquidity when placed, others rest in book and are filled as maker
+	taker bool
+	// canceled the rest of close order is canceled when the position is closed in spot or hedge mode
+	canceled bool
+}
+
+// newOrder create order, price is the last price when order placed
+func newOrder(act TradeAction, price float64) *order {
+	o := &order{TradeAction: act}
+	if price == 0 || act.Action.IsStop() || act.Action&Market == Market {
+		return o
+	}
+	if act.Action.IsLong() {
+		o.marketable = act.Price >= price
+	} else {
+		o.marketable = act.Price <= price
+	}
+	return o
+}
+
+// trail move the stop price of trailing stop with price
+func (o *order) trail(price float64) {
+	o.best, o.Price = o.opt.TrailStop(o.Action == StopLong, o.best, o.Price, price)
+}
+
+// isLimit return true if order is a limit order
+func (o *order) isLimit() bool {
+	return o.Action > 0 && o.Action&(Stop|Market) == 0
+}
+
+// remain return the amount can be filled now
+func (o *order) remain() float64 {
+	if o.canceled {
+		return 0
+	}
+	remain := o.Amount - o.filled
+	if o.group != nil {
+		remain = math.Min(remain, o.group.Remain(o.ID))
+	}
+	return remain
+}
+
+// done return true if the order can't be filled any more
+func (o *order) done() bool {
+	if o.group != nil {
+		return o.group.Done()
+	}
+	return o.remain() <= amountEpsilon
+}
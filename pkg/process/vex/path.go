@@ -0,0 +1,158 @@
+package vex
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/ztrade/trademodel"
+)
+
+// PricePath model of price path inside one candle, which decides fill order and price of orders
+type PricePath string
+
+const (
+	// PathOHLC open->high->low->close
+	PathOHLC PricePath = "ohlc"
+	// PathOLHC open->low->high->close
+	PathOLHC PricePath = "olhc"
+	// PathNearest visit the extreme nearest to open first
+	PathNearest PricePath = "nearest"
+	// PathPessimistic price moves against the position first, same as nearest if no position
+	PathPessimistic PricePath = "pessimistic"
+)
+
+// NewPricePath create price path model, empty means ohlc
+func NewPricePath(typ string) (p PricePath, err error) {
+	p = PricePath(typ)
+	switch p {
+	case "":
+		p = PathOHLC
+	case PathOHLC, PathOLHC, PathNearest, PathPessimistic:
+	default:
+		err = fmt.Errorf("unsupport price path: %s", typ)
+	}
+	return
+}
+
+// Points return the price points of path, pos is the position when candle begin
+func (p PricePath) Points(candle *Candle, pos float64) []float64 {
+	ohlc := []float64{candle.Open, candle.High, candle.Low, candle.Close}
+	olhc := []float64{candle.Open, candle.Low, candle.High, candle.Close}
+	switch p {
+	case PathOLHC:
+		return olhc
+	case PathPessimistic:
+		if pos > 0 {
+			return olhc
+		} else if pos < 0 {
+			return ohlc
+		}
+		fallthrough
+	case PathNearest:
+		if math.Abs(candle.Open-candle.Low) < math.Abs(candle.High-candle.Open) {
+			return olhc
+		}
+	}
+	return ohlc
+}
+
+// priceAt return the price of position at on path
+// at is the index of segment with fraction of the segment
+func priceAt(points []float64, at float64) float64 {
+	i := int(at)
+	if i >= len(points)-1 {
+		return points[len(points)-1]
+	}
+	return points[i] + (points[i+1]-points[i])*(at-float64(i))
+}
+
+// trigger find the first position on path not before from which reaches target
+// down means waiting for price <= target, otherwise price >= target
+// returns the position and the fill price
+func trigger(points []float64, from, target float64, down bool) (at, price float64, ok bool) {
+	reached := func(p float64) bool {
+		if down {
+			return p <= target
+		}
+		return p >= target
+	}
+	start := priceAt(points, from)
+	if reached(start) {
+		return from, start, true
+	}
+	for i := int(from); i < len(points)-1; i++ {
+		if !reached(points[i+1]) {
+			continue
+		}
+		at = float64(i) + (target-points[i])/(points[i+1]-points[i])
+		return at, target, true
+	}
+	return
+}
+
+// matchOrder return the position and price on path when the order is filled
+func matchOrder(points []float64, o *order) (at, price float64, side string, ok bool) {
+	switch o.Action {
+	case StopShort:
+		side = "buy"
+		if o.triggered {
+			return 0, points[0], side, true
+		} else if o.opt.IsTrailing() {
+			at, price, ok = trailStop(points, o)
+			return
+		}
+		at, price, ok = trigger(points, 0, o.Price, false)
+	case StopLong:
+		side = "sell"
+		if o.triggered {
+			return 0, points[0], side, true
+		} else if o.opt.IsTrailing() {
+			at, price, ok = trailStop(points, o)
+			return
+		}
+		at, price, ok = trigger(points, 0, o.Price, true)
+	case OpenLong, CloseShort:
+		side = "buy"
+		at, price, ok = trigger(points, 0, o.Price, true)
+		if ok && !o.marketable {
+			price = o.Price
+		}
+	case OpenShort, CloseLong:
+		side = "sell"
+		at, price, ok = trigger(points, 0, o.Price, false)
+		if ok && !o.marketable {
+			price = o.Price
+		}
+	default:
+		if o.Action&Market != Market {
+			log.Warnf("unsupport ActionType: %s", o.Action.String())
+			return
+		}
+		// market order is filled at the open of next candle
+		side = "sell"
+		if o.Action.IsLong() {
+			side = "buy"
+		}
+		at, price, ok = 0, points[0], true
+	}
+	return
+}
+
+// trailStop move the stop price of trailing stop along path until it is reached,
+// the best price changes only at points of path, so the stop is checked on the segment after each point
+func trailStop(points []float64, o *order) (at, price float64, ok bool) {
+	down := o.Action == StopLong
+	for i, p := range points {
+		o.trail(p)
+		end := i + 2
+		if end > len(points) {
+			end = len(points)
+		}
+		at, price, ok = trigger(points[i:end], 0, o.Price, down)
+		if ok {
+			return float64(i) + at, price, true
+		}
+	}
+	return
+}
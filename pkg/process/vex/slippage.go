@@ -0,0 +1,85 @@
+package vex
+
+import (
+	"fmt"
+
+	. "github.com/ztrade/trademodel"
+)
+
+// Slippage calculate the fill price of market and stop orders
+type Slippage interface {
+	Price(side string, price, amount float64, candle *Candle) float64
+}
+
+// NewSlippage create slippage model
+// typ: none,tick,percent,volume
+// tick: price moves value * tickSize against the order
+// percent: price moves value percent against the order, 0.1 means 0.1%
+// volume: price moves value * amount/candle.Volume against the order
+func NewSlippage(typ string, value, tickSize float64) (s Slippage, err error) {
+	switch typ {
+	case "", "none":
+		s = NoSlippage{}
+	case "tick":
+		if tickSize <= 0 {
+			err = fmt.Errorf("tick slippage must set tick size")
+			return
+		}
+		s = TickSlippage{Ticks: value, TickSize: tickSize}
+	case "percent":
+		s = PercentSlippage{Percent: value}
+	case "volume":
+		s = VolumeSlippage{Factor: value}
+	default:
+		err = fmt.Errorf("unsupport slippage type: %s", typ)
+	}
+	return
+}
+
+// adverse move price against the side of order
+func adverse(side string, price, diff float64) float64 {
+	if side == "buy" {
+		return price + diff
+	}
+	return price - diff
+}
+
+// NoSlippage fill at the price
+type NoSlippage struct{}
+
+func (s NoSlippage) Price(side string, price, amount float64, candle *Candle) float64 {
+	return price
+}
+
+// TickSlippage price moves fixed ticks against the order
+type TickSlippage struct {
+	Ticks    float64
+	TickSize float64
+}
+
+func (s TickSlippage) Price(side string, price, amount float64, candle *Candle) float64 {
+	return adverse(side, price, s.Ticks*s.TickSize)
+}
+
+// PercentSlippage price moves fixed percent against the order
+type PercentSlippage struct {
+	Percent float64
+}
+
+func (s PercentSlippage) Price(side string, price, amount float64, candle *Candle) float64 {
+	return adverse(side, price, price*s.Percent/100)
+}
+
+// VolumeSlippage price moves price*Factor*amount/volume, the ratio of amount to candle volume is 1 at most,
+// and it is 1 if volume is unknown, e.g. Factor 0.1 moves price 5% for the order of half the volume
+type VolumeSlippage struct {
+	Factor float64
+}
+
+func (s VolumeSlippage) Price(side string, price, amount float64, candle *Candle) float64 {
+	ratio := 1.0
+	if candle != nil && candle.Volume > 0 && amount < candle.Volume {
+		ratio = amount / candle.Volume
+	}
+	return adverse(side, price, price*s.Factor*ratio)
+}
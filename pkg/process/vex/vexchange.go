@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,32 +18,142 @@ import (
 	. "github.com/ztrade/trademodel"
 )
 
+// balancer balance of VExchange, leverBalance for futures, SpotBalance for spot and HedgeBalance for hedge mode
+type balancer interface {
+	Set(total float64)
+	SetFee(fee float64)
+	SetLever(lever float64)
+	Get() float64
+	Pos() float64
+	AddTrade(tr Trade) (profit, onceFee float64, err error)
+}
+
 // VExchange Virtual exchange impl FuturesBaseExchanger
 type VExchange struct {
 	BaseProcesser
-	candle   *Candle
-	trades   []Trade
-	orders   *list.List
+	candle *Candle
+	trades []Trade
+	orders *list.List
+	// groups linked order groups by id
+	groups map[string]*OrderGroup
+	// updates status updates of orders not sent
+	updates  []*Event
 	position float64
 	symbol   string
-	balance  *common.LeverBalance
-	// order index in same candle
-	orderIndex int
+	balance  balancer
+	// spot account holds base and quote assets, no lever and no short
+	spot bool
+	// hedge mode holds long and short positions independently
+	hedge bool
+	// balanceInit initial balance, used to calculate profit reported to account
+	balanceInit float64
+	account     *Account
+	slippage    Slippage
+	path        PricePath
+	// tickMode match orders with market trades instead of candles
+	tickMode bool
+	// participation max fill amount of order per candle as a fraction of candle volume, 0 means no limit
+	participation float64
+	// bookMode match limit orders with depth and queue position
+	bookMode bool
+	book     book
+	latency  Latency
+	// inflights order actions not arrived, sorted by arrival time
+	inflights []inflight
+
+	// entryPrice average open price of position
+	entryPrice float64
+	lever      float64
+	// mmr maintenance margin rate
+	mmr float64
+
+	fundingInterval time.Duration
+	fundingRates    []*FundingRate
+	fundingIndex    int
+	nextFunding     time.Time
+	// posFunding sum of funding payments since the position opened, used to calculate liquidation price
+	posFunding float64
+
+	fees *FeeSchedule
+	// volume traded volume in quote, used to find fee tier
+	volume float64
+
 	orderMutex sync.Mutex
 }
 
 func NewVExchange(symbol string) *VExchange {
 	ex := new(VExchange)
 	ex.Name = "VExchange"
+	ex.Symbol = symbol
 	ex.orders = list.New()
+	ex.groups = make(map[string]*OrderGroup)
 	ex.symbol = symbol
-	ex.balance = common.NewLeverBalance()
+	ex.balance = newLeverBalance()
+	ex.slippage = NoSlippage{}
+	ex.latency = NoLatency{}
+	ex.path = PathOHLC
+	ex.lever = 1
 	return ex
 }
 
+// SetSpot use spot account with base and quote assets instead of futures balance,
+// short orders are rejected and sell orders sell the base held at most
+func (ex *VExchange) SetSpot(spot bool) {
+	ex.spot = spot
+	if spot {
+		ex.balance = NewSpotBalance()
+		ex.lever = 1
+	} else {
+		ex.balance = newLeverBalance()
+	}
+}
+
+// SetHedge hold long and short positions independently, close orders close the position of their direction,
+// position is not liquidated in hedge mode, disabling hedge mode keeps the balance set by SetSpot
+func (ex *VExchange) SetHedge(hedge bool) {
+	if hedge {
+		ex.balance = NewHedgeBalance()
+		ex.balance.SetLever(ex.lever)
+	} else if ex.hedge {
+		ex.SetSpot(ex.spot)
+	}
+	ex.hedge = hedge
+}
+
+// SetMaintenanceMargin set the maintenance margin rate used to calculate liquidation price
+func (ex *VExchange) SetMaintenanceMargin(rate float64) {
+	ex.mmr = rate
+}
+
+// SetSlippage set the slippage model of market and stop orders
+func (ex *VExchange) SetSlippage(slippage Slippage) {
+	if slippage == nil {
+		slippage = NoSlippage{}
+	}
+	ex.slippage = slippage
+}
+
+// SetPricePath set the price path model inside candle
+func (ex *VExchange) SetPricePath(path PricePath) {
+	ex.path = path
+}
+
+// SetParticipation limit the fill amount of order in one candle to rate * volume of candle,
+// the rest of order keeps working in the next candles, 0 means orders are filled in full
+func (ex *VExchange) SetParticipation(rate float64) {
+	ex.participation = rate
+}
+
+// SetTickMode match orders with market trades instead of candles
+func (ex *VExchange) SetTickMode(tickMode bool) {
+	ex.tickMode = tickMode
+}
+
 func (b *VExchange) Init(bus *Bus) (err error) {
 	b.BaseProcesser.Init(bus)
 	b.Subscribe(EventCandle, b.onEventCandle)
+	b.Subscribe(EventTradeMarket, b.onEventTradeMarket)
+	b.Subscribe(EventDepth, b.onEventDepth)
 	b.Subscribe(EventOrder, b.onEventOrder)
 	b.Subscribe(EventBalanceInit, b.onEventBalanceInit)
 	b.Subscribe(EventRiskLimit, b.onEventRiskLimit)
@@ -50,132 +161,419 @@ func (b *VExchange) Init(bus *Bus) (err error) {
 }
 
 func (ex *VExchange) Start() (err error) {
-	ex.Send(ex.symbol, EventBalance, &Balance{Balance: ex.balance.Get()})
+	ex.Send(ex.symbol, EventBalance, &Balance{Balance: ex.totalBalance()})
 	return
 }
-func (ex *VExchange) processCandle(candle Candle) (err error) {
-	// TODO: check if liq
-	if ex.orders.Len() == 0 {
+
+// totalBalance balance with funding payments, it's the balance of account if account is shared
+func (ex *VExchange) totalBalance() float64 {
+	if ex.account != nil {
+		return ex.account.Total()
+	}
+	return ex.balance.Get()
+}
+
+// liqPrice return the liquidation price of position, 0 means position can't be liquidated
+func (ex *VExchange) liqPrice() (price float64) {
+	if ex.position == 0 || ex.lever <= 0 || ex.spot || ex.hedge {
 		return
 	}
-	ex.orderMutex.Lock()
-	defer ex.orderMutex.Unlock()
-	var posChange bool
-	var deleteElems []*list.Element
-	virtualTime := candle.Time()
-	var trades []*Event
+	// funding paid reduces the margin of position
+	funding := ex.posFunding / math.Abs(ex.position)
+	if ex.position > 0 {
+		price = ex.entryPrice*(1-1/ex.lever+ex.mmr) - funding
+	} else {
+		price = ex.entryPrice*(1+1/ex.lever-ex.mmr) + funding
+	}
+	if price < 0 {
+		price = 0
+	}
+	return
+}
+
+// updateEntryPrice update average open price after trade, pos is the position before trade
+func (ex *VExchange) updateEntryPrice(pos float64, tr *Trade) {
+	switch {
+	case ex.position == 0:
+		ex.entryPrice = 0
+		ex.posFunding = 0
+	case pos == 0 || (pos > 0) != (ex.position > 0):
+		ex.entryPrice = tr.Price
+		ex.posFunding = 0
+	case math.Abs(ex.position) > math.Abs(pos):
+		ex.entryPrice = (ex.entryPrice*math.Abs(pos) + tr.Price*tr.Amount) / math.Abs(ex.position)
+	}
+}
+
+// liquidate force close the position at liquidation price, all orders are canceled
+func (ex *VExchange) liquidate(price float64, tm time.Time) (events []*Event, err error) {
+	hold := ex.position
+	tr := Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
+		Time:   tm,
+		Price:  price,
+		Amount: math.Abs(hold),
+		Remark: RemarkLiquidation}
+	if hold > 0 {
+		tr.Action = CloseLong
+		tr.Side = "sell"
+	} else {
+		tr.Action = CloseShort
+		tr.Side = "buy"
+	}
+	ex.setFee(false)
+	_, _, err = ex.balance.AddTrade(tr)
+	if err != nil {
+		log.Errorf("vexchange liquidation balance AddTrade error:%s %f %f", err.Error(), tr.Price, tr.Amount)
+		return
+	}
+	log.Warnf("vexchange position %f liquidated at %f, entry price: %f", hold, price, ex.entryPrice)
+	ex.trades = append(ex.trades, tr)
+	ex.volume += tr.Amount * tr.Price
+	ex.position = ex.balance.Pos()
+	ex.updateEntryPrice(hold, &tr)
+	ex.syncAccount()
+	ex.removeOrders(OrderCanceled, RemarkLiquidation, func(o *order) bool {
+		return true
+	})
+	events = append(events,
+		ex.CreateEvent("trade", EventTrade, &tr),
+		ex.CreateEvent(ex.symbol, EventLiquidation, &Liquidation{Symbol: ex.symbol, Hold: hold, Price: price, Time: tm}))
+	return
+}
+
+// fillOrder fill amount of order at price, returns nil trade if order not works with current position
+func (ex *VExchange) fillOrder(o *order, price, amount float64, side string, tm time.Time) (tr *Trade, err error) {
+	v := o.TradeAction
+	filled := amount
+	if !v.Action.IsOpen() {
+		// stop order not works if position is zero
+		hold := ex.closable(v.Action)
+		if hold <= 0 {
+			return
+		}
+		// spot sells the base held at most, the fee of buy is deducted in base
+		if ex.spot || ex.hedge {
+			amount = math.Min(amount, hold)
+		}
+	}
+	t := Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
+		Action: v.Action,
+		Time:   tm,
+		Price:  price,
+		Amount: amount,
+		Side:   side,
+		Remark: RemarkTaker}
+	maker := o.isLimit() && !o.taker
+	if maker {
+		t.Remark = RemarkMaker
+	}
+	if v.ID != "" {
+		t.ID = v.ID
+	}
+	if ex.account != nil && v.Action.IsOpen() && ex.lever > 0 {
+		// margin of positions of all symbols must be covered by account
+		if ex.account.available(ex.symbol) < ex.margin()+amount*price/ex.lever {
+			err = common.ErrNoBalance
+			return
+		}
+	}
+	ex.setFee(maker)
+	// fix size
+	_, _, err = ex.balance.AddTrade(t)
+	if err != nil {
+		// log.Errorf("vexchange balance AddTrade error:%s %f %f", err.Error(), v.Price, v.Amount)
+		return
+	}
+	ex.trades = append(ex.trades, t)
+	ex.volume += amount * price
+	o.filled += amount
+	ex.fillGroups(o.ID, amount)
+	if o.filled >= o.Amount-amountEpsilon {
+		ex.orderUpdate(o, OrderFilled, "")
+	} else if amount < filled-amountEpsilon {
+		// nothing left to close
+		o.canceled = true
+		ex.orderUpdate(o, OrderCanceled, "position closed")
+	} else {
+		ex.orderUpdate(o, OrderPartiallyFilled, "")
+	}
+	hold := ex.position
+	ex.position = ex.balance.Pos()
+	ex.updateEntryPrice(hold, &t)
+	ex.syncAccount()
+	tr = &t
+	return
+}
+
+// closable return the position which can be closed by close order
+func (ex *VExchange) closable(typ TradeType) float64 {
+	if hb, ok := ex.balance.(*HedgeBalance); ok {
+		pos := hb.Position()
+		if IsLongLeg(typ) {
+			return pos.Long.Hold
+		}
+		return pos.Short.Hold
+	}
+	if ex.position > 0 && !typ.IsLong() {
+		return ex.position
+	} else if ex.position < 0 && typ.IsLong() {
+		return -ex.position
+	}
+	return 0
+}
+
+// setFee set the fee rate of the next trade by fee schedule
+func (ex *VExchange) setFee(maker bool) {
+	if ex.fees != nil {
+		ex.balance.SetFee(ex.fees.Rate(maker, ex.volume))
+	}
+}
+
+// positionEvents events of position and balance after position changed
+func (ex *VExchange) positionEvents(price float64) (events []*Event) {
 	var pos Position
-	var orderFilled bool
-	var side string
-	var price float64
+	pos.Symbol = ex.symbol
+	pos.Hold = ex.position
+	pos.Price = price
+	//		ex.Send(ex.symbol, EventCurPosition, pos)
+	events = append(events, ex.CreateEvent(ex.symbol, EventPosition, &pos))
+	if hb, ok := ex.balance.(*HedgeBalance); ok {
+		hedge := hb.Position()
+		hedge.Symbol = ex.symbol
+		events = append(events, ex.CreateEvent(ex.symbol, EventHedgePosition, &hedge))
+	}
+	if pos.Hold == 0 {
+		events = append(events, ex.CreateEvent(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.totalBalance()}))
+	}
+	return
+}
+
+// fill pending order which will be filled in candle
+type fill struct {
+	elem  *list.Element
+	o     *order
+	at    float64
+	price float64
+	side  string
+}
+
+// matchOrders fill orders and check liquidation along the price path of candle
+// tm is the begin time of candle, every fill moves time by step
+func (ex *VExchange) matchOrders(candle Candle, tm time.Time, step time.Duration) (events []*Event, err error) {
+	ex.expireOrders(tm)
+	points := ex.path.Points(&candle, ex.position)
+	var fills []fill
 	for elem := ex.orders.Front(); elem != nil; elem = elem.Next() {
-		orderFilled = false
-		v, ok := elem.Value.(TradeAction)
+		o, ok := elem.Value.(*order)
 		if !ok {
 			log.Errorf("order items type error:%##v", elem.Value)
 			continue
 		}
-		if !v.Action.IsOpen() {
-			// stop order not works if position is zero
-			if ex.position == 0 {
-				continue
-			} else if ex.position > 0 && v.Action.IsLong() {
-				continue
-			} else if ex.position < 0 && !v.Action.IsLong() {
-				continue
-			}
+		// limit orders are matched with depth in book mode
+		if ex.bookMode && o.isLimit() {
+			continue
 		}
-		// order can only be filled after next candle
-		price = v.Price
-
-		switch v.Action {
-		case StopShort:
-			if v.Price <= candle.High {
-				side = "buy"
-				orderFilled = true
-				if v.Price < candle.Low {
-					price = candle.Low
-				}
-			}
-		case StopLong:
-			if v.Price >= candle.Low {
-				side = "sell"
-				orderFilled = true
-				if v.Price > candle.High {
-					price = candle.High
-				}
-			}
-		case OpenLong, CloseShort:
-			if v.Price >= candle.Low {
-				side = "buy"
-				orderFilled = true
-				if v.Price > candle.High {
-					price = candle.High
-				}
-			}
-		case OpenShort, CloseLong:
-			if v.Price <= candle.High {
-				side = "sell"
-				orderFilled = true
-				if v.Price < candle.Low {
-					price = candle.Low
+		// legs of group wait for parent
+		if o.remain() <= amountEpsilon {
+			continue
+		}
+		at, price, side, ok := matchOrder(points, o)
+		// IOC and FOK orders only fill at the begin of candle
+		if !ok || (o.opt.IsImmediate() && at > 0) {
+			continue
+		}
+		fills = append(fills, fill{elem: elem, o: o, at: at, price: price, side: side})
+	}
+	sort.SliceStable(fills, func(i, j int) bool {
+		return fills[i].at < fills[j].at
+	})
+
+	virtualTime := tm
+	var posChange bool
+	var posPrice float64
+	var cur float64
+	var liqEvents []*Event
+	var tr *Trade
+	for i := 0; ; i++ {
+		// liquidation happens before the next fill
+		if liqPrice := ex.liqPrice(); liqPrice != 0 {
+			at, _, ok := trigger(points, cur, liqPrice, ex.position > 0)
+			if ok && (i >= len(fills) || at <= fills[i].at) {
+				virtualTime = virtualTime.Add(step)
+				liqEvents, err = ex.liquidate(liqPrice, virtualTime)
+				if err != nil {
+					return
 				}
+				events = append(events, liqEvents...)
+				posChange = true
+				posPrice = liqPrice
+				break
 			}
-		default:
-			log.Warnf("unsupport ActionType: %s", v.Action.String())
+		}
+		if i >= len(fills) {
+			break
+		}
+		f := fills[i]
+		cur = f.at
+		price := f.price
+		amount := f.o.remain()
+		// the leg is reduced by other legs filled before
+		if amount <= amountEpsilon {
 			continue
 		}
-
-		//		fmt.Println("action:", v.Action.String(), v.Price, candle.High, candle.Low, candle.Time(), orderFilled)
-		if !orderFilled {
+		if ex.participation > 0 && !ex.bookMode {
+			// the rest of order is left to the next candles
+			amount = math.Min(amount, ex.participation*candle.Volume)
+			if amount <= 0 {
+				continue
+			}
+		}
+		if f.o.opt.TimeInForce == FOK && amount < f.o.remain()-amountEpsilon {
 			continue
 		}
-
-		virtualTime = virtualTime.Add(time.Second)
-		tr := Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
-			Action: v.Action,
-			Time:   virtualTime,
-			Price:  price,
-			Amount: v.Amount,
-			Side:   side,
-			Remark: ""}
-		if v.ID != "" {
-			tr.ID = v.ID
+		if ex.bookMode {
+			// stop and market orders take the liquidity of book
+			if bookPrice, ok := ex.book.vwap(f.side == "buy", amount, 0); ok {
+				price = bookPrice
+			}
+		} else if f.o.Action.IsStop() || f.o.Action&Market == Market {
+			price = ex.slippage.Price(f.side, price, amount, &candle)
 		}
-		// fix size
-		_, _, err = ex.balance.AddTrade(tr)
+		tr, err = ex.fillOrder(f.o, price, amount, f.side, virtualTime.Add(step))
 		if err != nil {
-			// log.Errorf("vexchange balance AddTrade error:%s %f %f", err.Error(), v.Price, v.Amount)
 			return
 		}
-		ex.trades = append(ex.trades, tr)
-		tradeEvent := ex.CreateEvent("trade", EventTrade, &tr)
-		trades = append(trades, tradeEvent)
-
+		if tr == nil {
+			continue
+		}
+		virtualTime = virtualTime.Add(step)
+		events = append(events, ex.CreateEvent("trade", EventTrade, tr))
 		posChange = true
-		ex.position = ex.balance.Pos()
-		pos.Price = tr.Price
-		deleteElems = append(deleteElems, elem)
+		posPrice = tr.Price
+		if !f.o.done() {
+			f.o.triggered = f.o.Action.IsStop()
+			continue
+		}
+		ex.orders.Remove(f.elem)
+	}
+	// the rest of IOC and FOK orders are canceled
+	ex.removeOrders(OrderCanceled, "not filled immediately", func(o *order) bool {
+		return o.opt.IsImmediate()
+	})
+	ex.updateGroups()
+	if posChange {
+		events = append(events, ex.positionEvents(posPrice)...)
+	}
+	return
+}
+
+// crossed return true if the limit order would take liquidity when placed
+func (ex *VExchange) crossed(o *order) bool {
+	if ex.bookMode && len(ex.book.buys)+len(ex.book.sells) > 0 {
+		return ex.book.crossed(o)
+	}
+	return o.marketable
+}
+
+// amendOrder change the price or amount of working order, return the reason if failed,
+// the order loses its queue position unless only the amount is reduced
+func (ex *VExchange) amendOrder(act *TradeAction) (reason string) {
+	o := ex.findOrder(act.ID)
+	if o == nil {
+		return "order not found"
+	}
+	if act.Amount != 0 && act.Amount <= o.filled+amountEpsilon {
+		return fmt.Sprintf("amount %f not more than filled %f", act.Amount, o.filled)
 	}
-	for _, v := range deleteElems {
-		ex.orders.Remove(v)
+	var last float64
+	if ex.candle != nil {
+		last = ex.candle.Close
 	}
-	// keep trade time order
-	if len(trades) != 0 {
-		for i := len(trades) - 1; i >= 0; i-- {
-			ex.Bus.Send(trades[i])
+	if act.Price != 0 && act.Price != o.Price {
+		if o.opt.IsTrailing() {
+			return "price of trailing stop can't be amended"
+		}
+		if o.Action.IsStop() && last != 0 && !o.triggered {
+			if (o.Action == StopLong && act.Price >= last) || (o.Action == StopShort && act.Price <= last) {
+				return fmt.Sprintf("invalid stop price %f, last price: %f", act.Price, last)
+			}
+		}
+		na := o.TradeAction
+		na.Price = act.Price
+		n := newOrder(na, last)
+		if o.opt.TimeInForce == PostOnly && ex.crossed(n) {
+			return "post only order would take liquidity"
 		}
+		o.Price = act.Price
+		o.marketable = n.marketable
+		o.taker = !o.isLimit() || ex.crossed(n)
+		o.queued = false
 	}
-	if posChange {
-		pos.Symbol = ex.symbol
-		pos.Hold = ex.position
-		//		ex.Send(ex.symbol, EventCurPosition, pos)
-		ex.Send(ex.symbol, EventPosition, &pos)
-		if pos.Hold == 0 {
-			ex.Send(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.balance.Get()})
+	if act.Amount != 0 {
+		if act.Amount > o.Amount {
+			o.queued = false
+		}
+		o.Amount = act.Amount
+		if o.group != nil {
+			o.group.AddLeg(o.ID, act.Amount)
 		}
 	}
-	return nil
+	return
+}
+
+// removeOrders remove orders which fn returns true, and record their status
+func (ex *VExchange) removeOrders(status OrderState, reason string, fn func(o *order) bool) {
+	var next *list.Element
+	for elem := ex.orders.Front(); elem != nil; elem = next {
+		next = elem.Next()
+		o, ok := elem.Value.(*order)
+		if ok && fn(o) {
+			ex.orders.Remove(elem)
+			ex.orderUpdate(o, status, reason)
+		}
+	}
+}
+
+// expireOrders remove GTD orders expired before tm
+func (ex *VExchange) expireOrders(tm time.Time) {
+	ex.removeOrders(OrderExpired, "", func(o *order) bool {
+		return o.opt.TimeInForce == GTD && !o.opt.ExpireTime.After(tm)
+	})
+}
+
+func (ex *VExchange) processCandle(candle Candle) (err error) {
+	err = ex.process(candle, candle.Time(), time.Second)
+	return
+}
+
+// processTick match orders with market trade
+func (ex *VExchange) processTick(trade *Trade) (err error) {
+	candle := Candle{Start: trade.Time.Unix(), Open: trade.Price, High: trade.Price, Low: trade.Price, Close: trade.Price, Volume: trade.Amount}
+	err = ex.process(candle, trade.Time, 0)
+	return
+}
+
+func (ex *VExchange) process(candle Candle, tm time.Time, step time.Duration) (err error) {
+	ex.processFunding(candle)
+	ex.orderMutex.Lock()
+	// orders arrived before candle are placed with the last price
+	events, err := ex.arriveOrders(tm)
+	ex.candle = &candle
+	if err == nil {
+		var matched []*Event
+		matched, err = ex.matchOrders(candle, tm, step)
+		events = append(events, matched...)
+	}
+	if spot, ok := ex.balance.(*SpotBalance); ok {
+		spot.SetPrice(candle.Close)
+	}
+	events = append(events, ex.takeUpdates()...)
+	ex.orderMutex.Unlock()
+	// send events after unlock, so orders can be sent when process these events
+	for _, e := range events {
+		ex.Bus.Send(e)
+	}
+	return
 }
 
 func (ex *VExchange) onEventCandle(e *Event) (err error) {
@@ -185,58 +583,169 @@ func (ex *VExchange) onEventCandle(e *Event) (err error) {
 		return
 	}
 	// fmt.Println("candle:", e.Name, e.GetType(), e.GetData())
+	if !ex.MatchSymbol(e) {
+		return
+	}
 	binSize := e.GetExtra().(string)
-	if binSize != "1m" {
+	if binSize != "1m" || ex.tickMode {
 		return
 	}
 
-	ex.candle = candle
-	ex.orderIndex = 0
 	err = ex.processCandle(*candle)
 	return
 }
 
+func (ex *VExchange) onEventTradeMarket(e *Event) (err error) {
+	if !ex.tickMode || !ex.MatchSymbol(e) {
+		return
+	}
+	trade, ok := e.GetData().(*Trade)
+	if !ok {
+		err = fmt.Errorf("VExchange trade type error:%s", reflect.TypeOf(e.GetData()))
+		return
+	}
+	if ex.bookMode {
+		err = ex.processBookTrade(trade)
+		if err != nil {
+			return
+		}
+	}
+	err = ex.processTick(trade)
+	return
+}
+
 func (ex *VExchange) onEventOrder(e *Event) (err error) {
-	ex.orderMutex.Lock()
-	defer ex.orderMutex.Unlock()
+	if !ex.MatchSymbol(e) {
+		return
+	}
 	act := e.GetData().(*TradeAction)
 	if act == nil {
 		log.Errorf("decode tradeaction error: %##v", e.GetData())
 		return
 	}
-	if act.Action == trademodel.CancelAll {
-		ex.orders = list.New()
+	var opt OrderOption
+	if v, ok := e.GetExtra().(*OrderOption); ok && v != nil {
+		opt = *v
+	}
+	ex.orderMutex.Lock()
+	if !ex.sendOrder(act, opt) {
+		ex.orderMutex.Unlock()
 		return
-	} else if act.Action == trademodel.CancelOne {
-		for item := ex.orders.Front(); item != nil; item.Next() {
-			od := item.Value.(TradeAction)
-			if od.ID == act.ID {
-				ex.orders.Remove(item)
-				return
-			}
+	}
+	events, err := ex.addOrder(act, opt, ex.Now())
+	ex.updateGroups()
+	events = append(events, ex.takeUpdates()...)
+	ex.orderMutex.Unlock()
+	for _, e := range events {
+		ex.Bus.Send(e)
+	}
+	return
+}
+
+// addOrder add order to pending orders, or cancel orders, tm is the time action arrives
+func (ex *VExchange) addOrder(act *TradeAction, opt OrderOption, tm time.Time) (events []*Event, err error) {
+	switch act.Action {
+	case trademodel.CancelAll:
+		ex.removeOrders(OrderCanceled, "", func(o *order) bool {
+			return true
+		})
+		return
+	case trademodel.CancelOne:
+		ex.removeOrders(OrderCanceled, "", func(o *order) bool {
+			return o.ID == act.ID
+		})
+		return
+	case AmendOne:
+		amend := OrderAmend{Action: *act, Reason: ex.amendOrder(act)}
+		if amend.Reason != "" {
+			log.Warnf("VExchange amend order %s failed: %s", act.ID, amend.Reason)
 		}
+		events = append(events, ex.CreateEvent(act.ID, EventOrderAmend, &amend))
 		return
 	}
+	act.Time = tm
+	var price float64
 	if ex.candle != nil {
-		act.Time = ex.candle.Time().Add(time.Second * time.Duration(ex.orderIndex))
-		if act.Action == StopLong && act.Price >= ex.candle.Close {
-			log.Warnf("invalid stop long order,action: %#v, candle: %s", *act, *ex.candle)
-			return
-		} else if act.Action == StopShort && act.Price <= ex.candle.Close {
-			log.Warnf("invalid stop short order,action: %#v, candle: %s", *act, *ex.candle)
-			return
+		price = ex.candle.Close
+	}
+	o := newOrder(*act, price)
+	o.opt = opt
+	if reason := ex.checkOrder(o); reason != "" {
+		log.Warnf("VExchange reject order %#v: %s", *act, reason)
+		ex.orderUpdate(o, OrderRejected, reason)
+		return
+	}
+	if opt.IsTrailing() && price != 0 {
+		o.trail(price)
+	}
+	o.taker = !o.isLimit() || ex.crossed(o)
+	ex.orderUpdate(o, OrderNew, "")
+	if ex.bookMode && o.isLimit() && opt.IsImmediate() {
+		events, err = ex.matchImmediate(o, act.Time)
+		return
+	}
+	if opt.IsGrouped() {
+		ex.addGroupLeg(o)
+	}
+	ex.orders.PushBack(o)
+	return
+}
+
+// checkOrder return the reason if the new order is invalid
+func (ex *VExchange) checkOrder(o *order) (reason string) {
+	opt := o.opt
+	if err := opt.Validate(); err != nil {
+		return "invalid order option: " + err.Error()
+	}
+	if opt.IsTrailing() && !o.Action.IsStop() {
+		return "trailing option of not stop order"
+	}
+	// buy to close or sell to open is short
+	if ex.spot && o.Action.IsLong() != o.Action.IsOpen() {
+		return "short not allowed in spot account"
+	}
+	if ex.candle != nil && !opt.IsTrailing() {
+		if o.Action == StopLong && o.Price >= ex.candle.Close {
+			return fmt.Sprintf("invalid stop long price %f, last price: %f", o.Price, ex.candle.Close)
+		} else if o.Action == StopShort && o.Price <= ex.candle.Close {
+			return fmt.Sprintf("invalid stop short price %f, last price: %f", o.Price, ex.candle.Close)
+		}
+	}
+	switch opt.TimeInForce {
+	case GTD:
+		if !opt.ExpireTime.After(o.Time) {
+			return fmt.Sprintf("GTD order expired at %s", opt.ExpireTime)
+		}
+	case PostOnly:
+		if !o.isLimit() || ex.crossed(o) {
+			return "post only order would take liquidity"
 		}
 	}
-	ex.orderIndex++
-	ex.orders.PushBack(*act)
+	return
+}
+
+// orderUpdate record status update of order, updates are sent after the events of processing orders
+func (ex *VExchange) orderUpdate(o *order, status OrderState, reason string) {
+	update := OrderUpdate{Action: o.TradeAction, Status: status, Filled: o.filled, Reason: reason, Time: ex.Now()}
+	ex.updates = append(ex.updates, ex.CreateEvent(o.ID, EventOrderStatus, &update))
+}
+
+// takeUpdates return the recorded status updates of orders
+func (ex *VExchange) takeUpdates() (events []*Event) {
+	events, ex.updates = ex.updates, nil
 	return
 }
 
 func (ex *VExchange) onEventBalanceInit(e *Event) (err error) {
 	balance := e.GetData().(*BalanceInfo)
 	ex.balance.Set(balance.Balance)
+	ex.balanceInit = balance.Balance
+	if ex.account != nil {
+		ex.account.setBalance(balance.Balance)
+	}
 	ex.balance.SetFee(balance.Fee)
-	ex.Send(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.balance.Get()})
+	ex.fees = balance.Fees
+	ex.Send(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.totalBalance()})
 	return
 }
 
@@ -247,48 +756,66 @@ func (ex *VExchange) onEventRiskLimit(e *Event) (err error) {
 		log.Error(err.Error())
 		return
 	}
+	if info.Lever <= 0 || ex.spot {
+		return
+	}
 	ex.balance.SetLever(info.Lever)
+	ex.lever = info.Lever
 	return
 }
 
 func (ex *VExchange) CloseAll() (err error) {
-	if ex.position == 0 {
-		return
+	var closes []TradeType
+	if hb, ok := ex.balance.(*HedgeBalance); ok {
+		pos := hb.Position()
+		if pos.Long.Hold > 0 {
+			closes = append(closes, CloseLong)
+		}
+		if pos.Short.Hold > 0 {
+			closes = append(closes, CloseShort)
+		}
+	} else if ex.position > 0 {
+		closes = append(closes, CloseLong)
+	} else if ex.position < 0 {
+		closes = append(closes, CloseShort)
 	}
-	virtualTime := ex.candle.Time().Add(time.Second)
-	var tr Trade
-	if ex.position > 0 {
-		tr = Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
-			Action: CloseLong,
-			Time:   virtualTime,
-			Price:  ex.candle.Close,
-			Amount: math.Abs(ex.position),
-			Side:   "sell",
-			Remark: ""}
-	} else {
-		tr = Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
-			Action: CloseShort,
-			Time:   virtualTime,
-			Price:  ex.candle.Close,
-			Amount: math.Abs(ex.position),
-			Side:   "buy",
-			Remark: ""}
-	}
-	tradeEvent := ex.CreateEvent("trade", EventTrade, &tr)
-	ex.Bus.Send(tradeEvent)
-	_, _, err = ex.balance.AddTrade(tr)
-	if err != nil {
-		log.Errorf("vexchange CloseALll balance AddTrade error:%s %f %f", err.Error(), tr.Price, tr.Amount)
+	if len(closes) == 0 {
 		return
 	}
+	for _, typ := range closes {
+		tr := ex.closeTrade(typ)
+		tradeEvent := ex.CreateEvent("trade", EventTrade, &tr)
+		ex.Bus.Send(tradeEvent)
+		ex.setFee(false)
+		_, _, err = ex.balance.AddTrade(tr)
+		if err != nil {
+			log.Errorf("vexchange CloseALll balance AddTrade error:%s %f %f", err.Error(), tr.Price, tr.Amount)
+			return
+		}
+		// trades are recorded so the ids of close trades are unique
+		ex.trades = append(ex.trades, tr)
+	}
 	ex.position = ex.balance.Pos()
-	var pos Position
-	pos.Symbol = ex.symbol
-	pos.Hold = ex.position
-	//		ex.Send(ex.symbol, EventCurPosition, pos)
-	ex.Send(ex.symbol, EventPosition, &pos)
-	if pos.Hold == 0 {
-		ex.Send(ex.symbol, EventBalance, &Balance{Currency: ex.symbol, Balance: ex.balance.Get()})
+	ex.entryPrice = 0
+	ex.posFunding = 0
+	ex.syncAccount()
+	for _, e := range ex.positionEvents(ex.candle.Close) {
+		ex.Bus.Send(e)
 	}
 	return
 }
+
+// closeTrade trade to close the position which can be closed by typ at last price
+func (ex *VExchange) closeTrade(typ TradeType) Trade {
+	side := "sell"
+	if typ.IsLong() {
+		side = "buy"
+	}
+	return Trade{ID: fmt.Sprintf("%d", len(ex.trades)),
+		Action: typ,
+		Time:   ex.Now(),
+		Price:  ex.candle.Close,
+		Amount: ex.closable(typ),
+		Side:   side,
+		Remark: RemarkTaker}
+}
@@ -0,0 +1,641 @@
+package vex
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/ztrade/trademodel"
+	. "github.com/ztrade/ztrade/pkg/core"
+	. "github.com/ztrade/ztrade/pkg/event"
+)
+
+type recorder struct {
+	BaseProcesser
+	trades   []Trade
+	liqs     []Liquidation
+	fundings []Funding
+}
+
+func (r *recorder) Init(bus *Bus) (err error) {
+	r.BaseProcesser.Init(bus)
+	r.Subscribe(EventTrade, func(e *Event) error {
+		r.trades = append(r.trades, *e.GetData().(*Trade))
+		return nil
+	})
+	r.Subscribe(EventFunding, func(e *Event) error {
+		r.fundings = append(r.fundings, *e.GetData().(*Funding))
+		return nil
+	})
+	r.Subscribe(EventLiquidation, func(e *Event) error {
+		r.liqs = append(r.liqs, *e.GetData().(*Liquidation))
+		return nil
+	})
+	return
+}
+
+func newTestVExchange(t *testing.T) (param *BaseProcesser, ex *VExchange, rec *recorder) {
+	param = NewBaseProcesser("param")
+	ex = NewVExchange("BTCUSDT")
+	rec = &recorder{BaseProcesser: BaseProcesser{Name: "recorder"}}
+	procs := NewSyncProcessers()
+	procs.Adds(param, ex, rec)
+	err := procs.Start()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 100000})
+	param.Send("risk_init", EventRiskLimit, &RiskLimit{Lever: 1})
+	return
+}
+
+func sendCandle(param *BaseProcesser, start int64, open, high, low, close float64) {
+	param.SendWithExtra("candle", EventCandle, &Candle{Start: start, Open: open, High: high, Low: low, Close: close, Volume: 100}, "1m")
+}
+
+func TestMarketOrderSlippage(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetSlippage(TickSlippage{Ticks: 2, TickSize: 0.5})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: Market | OpenLong, Amount: 1})
+	sendCandle(param, 1600000060, 102, 103, 101, 102)
+	if len(rec.trades) != 1 || rec.trades[0].Price != 103 || rec.trades[0].Side != "buy" {
+		t.Fatalf("market order should be filled at next open with slippage: %#v", rec.trades)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: StopLong, Price: 100, Amount: 1})
+	sendCandle(param, 1600000120, 101, 101, 98, 99)
+	if len(rec.trades) != 2 || rec.trades[1].Price != 99 || rec.trades[1].Side != "sell" {
+		t.Fatalf("stop order should be filled with slippage: %#v", rec.trades)
+	}
+}
+
+func TestLiquidation(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetMaintenanceMargin(0.005)
+	param.Send("risk_init", EventRiskLimit, &RiskLimit{Lever: 10})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 10})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: StopLong, Price: 80, Amount: 10})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	sendCandle(param, 1600000120, 100, 100, 91, 92)
+	if len(rec.liqs) != 0 {
+		t.Fatalf("position should not be liquidated: %#v", rec.liqs)
+	}
+	sendCandle(param, 1600000180, 92, 93, 85, 88)
+	if len(rec.liqs) != 1 || len(rec.trades) != 2 {
+		t.Fatalf("position should be liquidated: %#v %#v", rec.liqs, rec.trades)
+	}
+	tr := rec.trades[1]
+	if tr.Remark != RemarkLiquidation || tr.Action != CloseLong || tr.Price != 90.5 || tr.Amount != 10 {
+		t.Fatalf("liquidation trade error: %#v", tr)
+	}
+	if ex.orders.Len() != 0 {
+		t.Fatal("orders should be canceled after liquidation")
+	}
+}
+
+func TestFunding(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetFunding(time.Hour, []*FundingRate{{Start: 1600000000, Rate: 0.001}, {Start: 1600005600, Rate: -0.002}})
+	sendCandle(param, 1600001880, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 10})
+	sendCandle(param, 1600001940, 100, 101, 99, 100)
+	sendCandle(param, 1600002000, 100, 101, 99, 100)
+	if len(rec.fundings) != 1 || rec.fundings[0].Amount != -1 {
+		t.Fatalf("long position should pay funding: %#v", rec.fundings)
+	}
+	bal := ex.totalBalance()
+	sendCandle(param, 1600005600, 100, 101, 99, 100)
+	if len(rec.fundings) != 2 || rec.fundings[1].Amount != 2 || math.Abs(ex.balance.Get()-bal-2) > 1e-9 {
+		t.Fatalf("long position should receive funding: %#v %f", rec.fundings, ex.balance.Get())
+	}
+}
+
+func TestFundingLiquidation(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetMaintenanceMargin(0.005)
+	param.Send("risk_init", EventRiskLimit, &RiskLimit{Lever: 10})
+	ex.SetFunding(time.Hour, []*FundingRate{{Start: 1600000000, Rate: 0.01, MarkPrice: 100}})
+	sendCandle(param, 1600001880, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 10})
+	sendCandle(param, 1600001940, 100, 101, 99, 100)
+	if ex.liqPrice() != 90.5 {
+		t.Fatalf("liquidation price error: %f", ex.liqPrice())
+	}
+	sendCandle(param, 1600002000, 100, 100, 91, 92)
+	if len(rec.fundings) != 1 || len(rec.liqs) != 1 || rec.liqs[0].Price != 91.5 {
+		t.Fatalf("funding paid should raise liquidation price: %#v %#v", rec.fundings, rec.liqs)
+	}
+}
+
+func TestSpotNoFunding(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetSpot(true)
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	ex.SetFunding(time.Hour, []*FundingRate{{Start: 1600000000, Rate: 0.01}})
+	sendCandle(param, 1600001880, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 5})
+	sendCandle(param, 1600001940, 100, 101, 99, 100)
+	bal := ex.totalBalance()
+	sendCandle(param, 1600002000, 100, 101, 99, 100)
+	if ex.position == 0 || len(rec.fundings) != 0 || ex.totalBalance() != bal {
+		t.Fatalf("funding should not be settled in spot account: %#v", rec.fundings)
+	}
+}
+
+func TestPricePath(t *testing.T) {
+	paths := map[PricePath]float64{PathOHLC: 110, PathOLHC: 90, PathNearest: 90, PathPessimistic: 90}
+	for path, price := range paths {
+		param, ex, rec := newTestVExchange(t)
+		ex.SetPricePath(path)
+		sendCandle(param, 1600000000, 100, 101, 99, 100)
+		param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 1})
+		sendCandle(param, 1600000060, 100, 101, 99, 100)
+		param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: CloseLong, Price: 110, Amount: 1})
+		param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: StopLong, Price: 90, Amount: 1})
+		sendCandle(param, 1600000120, 100, 112, 89, 100)
+		if len(rec.trades) != 2 || rec.trades[1].Price != price {
+			t.Fatalf("path %s should close at %f: %#v", path, price, rec.trades)
+		}
+	}
+}
+
+func TestTickMode(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetTickMode(true)
+	tm := time.Unix(1600000000, 0)
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm, Price: 100, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 99, Amount: 1})
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(time.Millisecond), Price: 99.5, Amount: 1})
+	sendCandle(param, 1600000000, 100, 101, 98, 100)
+	if len(rec.trades) != 0 {
+		t.Fatalf("order should not be filled by candle in tick mode: %#v", rec.trades)
+	}
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(time.Second), Price: 98.5, Amount: 1})
+	if len(rec.trades) != 1 || rec.trades[0].Price != 99 || !rec.trades[0].Time.Equal(tm.Add(time.Second)) {
+		t.Fatalf("order should be filled by market trade: %#v", rec.trades)
+	}
+}
+
+func TestSlippageModels(t *testing.T) {
+	candle := &Candle{Volume: 100}
+	s, err := NewSlippage("percent", 1, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if price := s.Price("sell", 100, 1, candle); price != 99 {
+		t.Fatalf("percent slippage error: %f", price)
+	}
+	s, err = NewSlippage("volume", 0.1, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if price := s.Price("buy", 100, 50, candle); price != 105 {
+		t.Fatalf("volume slippage error: %f", price)
+	}
+	_, err = NewSlippage("tick", 1, 0)
+	if err == nil {
+		t.Fatal("tick slippage without tick size should fail")
+	}
+}
+
+func TestBookMode(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetBookMode(true)
+	tm := time.Unix(1600000000, 0)
+	sendDepth := func(tm time.Time, bid, ask float64) {
+		param.Send("BTCUSDT", EventDepth, &Depth{
+			Buys:       []DepthInfo{{Price: bid - 1, Amount: 10}, {Price: bid, Amount: 5}},
+			Sells:      []DepthInfo{{Price: ask, Amount: 1}, {Price: ask + 1, Amount: 10}},
+			UpdateTime: tm})
+	}
+	sendDepth(tm, 99, 100)
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm, Price: 100, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 99, Amount: 1})
+	sendDepth(tm.Add(time.Second), 99, 100)
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(2 * time.Second), Price: 99, Amount: 4})
+	if len(rec.trades) != 0 {
+		t.Fatalf("order should wait in queue: %#v", rec.trades)
+	}
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(3 * time.Second), Price: 99, Amount: 2})
+	if len(rec.trades) != 1 || rec.trades[0].Price != 99 {
+		t.Fatalf("order should be filled after queue consumed: %#v", rec.trades)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 102, Amount: 2})
+	sendDepth(tm.Add(4*time.Second), 99, 100)
+	if len(rec.trades) != 2 || rec.trades[1].Price != 100.5 {
+		t.Fatalf("crossing order should take book levels: %#v", rec.trades)
+	}
+}
+
+func TestBookPartialFill(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetBookMode(true)
+	tm := time.Unix(1600000000, 0)
+	depth := &Depth{
+		Buys:       []DepthInfo{{Price: 98, Amount: 10}, {Price: 99, Amount: 5}},
+		Sells:      []DepthInfo{{Price: 100, Amount: 1}, {Price: 101, Amount: 10}},
+		UpdateTime: tm}
+	param.Send("BTCUSDT", EventDepth, depth)
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm, Price: 100, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 99, Amount: 3})
+	depth.UpdateTime = tm.Add(time.Second)
+	param.Send("BTCUSDT", EventDepth, depth)
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(2 * time.Second), Price: 99, Amount: 6})
+	if len(rec.trades) != 1 || rec.trades[0].Amount != 1 {
+		t.Fatalf("only the amount traded beyond queue should be filled: %#v", rec.trades)
+	}
+	param.Send("BTCUSDT", EventTradeMarket, &Trade{Time: tm.Add(3 * time.Second), Price: 99, Amount: 1})
+	if len(rec.trades) != 2 || rec.trades[1].Amount != 1 || ex.position != 2 {
+		t.Fatalf("order at front of queue should be filled by the next trade: %#v", rec.trades)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 100, Amount: 3})
+	depth.UpdateTime = tm.Add(4 * time.Second)
+	param.Send("BTCUSDT", EventDepth, depth)
+	if len(rec.trades) != 3 || rec.trades[2].Amount != 1 || rec.trades[2].Price != 100 {
+		t.Fatalf("crossing order should only take the levels within limit: %#v", rec.trades)
+	}
+	var resting float64
+	for elem := ex.orders.Front(); elem != nil; elem = elem.Next() {
+		if o := elem.Value.(*order); o.ID == "2" {
+			resting = o.remain()
+		}
+	}
+	if resting != 2 {
+		t.Fatalf("the rest of crossing order should keep resting: %f", resting)
+	}
+	param.Send("BTCUSDT", EventDepth, &Depth{
+		Buys:       []DepthInfo{{Price: 96, Amount: 10}, {Price: 97, Amount: 5}},
+		Sells:      []DepthInfo{{Price: 98, Amount: 1}, {Price: 99, Amount: 10}},
+		UpdateTime: tm.Add(5 * time.Second)})
+	if len(rec.trades) != 5 || rec.trades[3].Price != 99 || rec.trades[4].Amount != 2 || rec.trades[4].Price != 100 || rec.trades[4].Remark != RemarkMaker {
+		t.Fatalf("resting order traded through should be filled at its price: %#v", rec.trades)
+	}
+}
+
+func TestPortfolioAccount(t *testing.T) {
+	param := NewBaseProcesser("param")
+	account := NewAccount()
+	btc := NewVExchange("BTCUSDT")
+	btc.SetAccount(account)
+	eth := NewVExchange("ETHUSDT")
+	eth.SetAccount(account)
+	rec := &recorder{BaseProcesser: BaseProcesser{Name: "recorder"}}
+	procs := NewSyncProcessers()
+	procs.Adds(param, btc, eth, rec)
+	err := procs.Start()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	param.Send("risk_init", EventRiskLimit, &RiskLimit{Lever: 1})
+	sendSymbolCandle := func(symbol string, start int64, price float64) {
+		e := NewEvent("candle", EventCandle, "param", &Candle{Start: start, Open: price, High: price, Low: price, Close: price, Volume: 100}, "1m")
+		e.Symbol = symbol
+		param.Bus.Send(e)
+	}
+	sendOrder := func(symbol string, act *TradeAction) {
+		e := NewEvent(EventOrder, EventOrder, "param", act, nil)
+		e.Symbol = symbol
+		param.Bus.Send(e)
+	}
+	sendSymbolCandle("BTCUSDT", 1600000000, 100)
+	sendSymbolCandle("ETHUSDT", 1600000000, 10)
+	sendOrder("BTCUSDT", &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 6})
+	sendOrder("ETHUSDT", &TradeAction{ID: "2", Action: OpenLong, Price: 10, Amount: 10})
+	sendSymbolCandle("BTCUSDT", 1600000060, 100)
+	if len(rec.trades) != 1 || btc.position != 6 || eth.position != 0 {
+		t.Fatalf("only order of BTCUSDT should be filled: %#v", rec.trades)
+	}
+	sendSymbolCandle("ETHUSDT", 1600000060, 10)
+	if len(rec.trades) != 2 || eth.position != 10 {
+		t.Fatalf("order of ETHUSDT should be filled: %#v", rec.trades)
+	}
+	sendOrder("ETHUSDT", &TradeAction{ID: "3", Action: OpenLong, Price: 10, Amount: 40})
+	sendSymbolCandle("ETHUSDT", 1600000120, 10)
+	if len(rec.trades) != 2 {
+		t.Fatalf("order should not be filled without enough shared margin: %#v", rec.trades)
+	}
+	sendOrder("BTCUSDT", &TradeAction{ID: "4", Action: CloseLong, Price: 110, Amount: 6})
+	sendSymbolCandle("BTCUSDT", 1600000180, 110)
+	if len(rec.trades) != 3 || account.Total() != 1060 || eth.totalBalance() != 1060 {
+		t.Fatalf("profit should be shared by account: %f %#v", account.Total(), rec.trades)
+	}
+}
+
+func TestParticipation(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetParticipation(0.1)
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 25})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	sendCandle(param, 1600000120, 102, 103, 101, 102)
+	if len(rec.trades) != 1 || rec.trades[0].Amount != 10 || ex.position != 10 {
+		t.Fatalf("order should be partially filled by candle volume: %#v", rec.trades)
+	}
+	sendCandle(param, 1600000180, 100, 101, 99, 100)
+	sendCandle(param, 1600000240, 100, 101, 99, 100)
+	if len(rec.trades) != 3 || rec.trades[2].Amount != 5 || ex.position != 25 || ex.orders.Len() != 0 {
+		t.Fatalf("rest of order should be filled in next candles: %#v", rec.trades)
+	}
+	for _, v := range rec.trades {
+		if v.ID != "1" {
+			t.Fatalf("all trades should belong to the order: %#v", rec.trades)
+		}
+	}
+}
+
+func TestTimeInForce(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	param.Bus.SetClock(NewVirtualClock())
+	sendOrder := func(act *TradeAction, opt OrderOption) {
+		param.SendWithExtra(EventOrder, EventOrder, act, &opt)
+	}
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	sendOrder(&TradeAction{ID: "1", Action: OpenLong, Price: 101, Amount: 1}, OrderOption{TimeInForce: PostOnly})
+	if ex.orders.Len() != 0 {
+		t.Fatal("post only order should be rejected when it would cross")
+	}
+	sendOrder(&TradeAction{ID: "2", Action: OpenLong, Price: 99, Amount: 1}, OrderOption{TimeInForce: IOC})
+	sendOrder(&TradeAction{ID: "3", Action: OpenLong, Price: 101, Amount: 20}, OrderOption{TimeInForce: FOK})
+	ex.SetParticipation(0.1)
+	sendCandle(param, 1600000060, 100, 101, 98, 100)
+	if len(rec.trades) != 0 || ex.orders.Len() != 0 {
+		t.Fatalf("IOC and FOK orders should be canceled: %#v", rec.trades)
+	}
+	ex.SetParticipation(0)
+	sendOrder(&TradeAction{ID: "4", Action: OpenLong, Price: 101, Amount: 1}, OrderOption{TimeInForce: IOC})
+	sendOrder(&TradeAction{ID: "5", Action: OpenLong, Price: 99, Amount: 1}, OrderOption{TimeInForce: GTD, ExpireTime: time.Unix(1600000150, 0)})
+	sendOrder(&TradeAction{ID: "6", Action: OpenLong, Price: 99, Amount: 1}, OrderOption{TimeInForce: PostOnly})
+	sendCandle(param, 1600000120, 100, 101, 100, 100)
+	if len(rec.trades) != 1 || rec.trades[0].ID != "4" || ex.orders.Len() != 2 {
+		t.Fatalf("IOC order should be filled at open: %#v", rec.trades)
+	}
+	sendCandle(param, 1600000180, 100, 101, 98, 100)
+	if len(rec.trades) != 2 || rec.trades[1].ID != "6" {
+		t.Fatalf("GTD order should be expired: %#v", rec.trades)
+	}
+}
+
+func TestOrderGroup(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	sendOrder := func(act *TradeAction, opt OrderOption) {
+		param.SendWithExtra(EventOrder, EventOrder, act, &opt)
+	}
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	// bracket
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 100, Amount: 2})
+	sendOrder(&TradeAction{ID: "2", Action: CloseLong, Price: 110, Amount: 2}, OrderOption{GroupID: "1", ParentID: "1"})
+	sendOrder(&TradeAction{ID: "3", Action: StopLong, Price: 95, Amount: 2}, OrderOption{GroupID: "1", ParentID: "1"})
+	ex.SetParticipation(0.01)
+	sendCandle(param, 1600000060, 100, 101, 94, 100)
+	if len(rec.trades) != 1 || ex.position != 1 || ex.orders.Len() != 3 {
+		t.Fatalf("legs should wait for entry: %#v", rec.trades)
+	}
+	ex.SetParticipation(0)
+	sendCandle(param, 1600000120, 100, 100, 94, 95)
+	if len(rec.trades) != 3 || rec.trades[2].ID != "3" || rec.trades[2].Amount != 2 || ex.position != 0 {
+		t.Fatalf("stop loss should be sized by filled entry: %#v", rec.trades)
+	}
+	if ex.orders.Len() != 0 || len(ex.groups) != 0 {
+		t.Fatal("take profit should be canceled")
+	}
+	// oco
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "4", Action: OpenLong | Market, Amount: 2})
+	sendCandle(param, 1600000180, 100, 101, 99, 100)
+	sendOrder(&TradeAction{ID: "5", Action: CloseLong, Price: 110, Amount: 2}, OrderOption{GroupID: "5"})
+	sendOrder(&TradeAction{ID: "6", Action: StopLong, Price: 90, Amount: 2}, OrderOption{GroupID: "5"})
+	ex.SetParticipation(0.01)
+	sendCandle(param, 1600000240, 100, 111, 99, 100)
+	if len(rec.trades) != 5 || rec.trades[4].ID != "5" || ex.position != 1 {
+		t.Fatalf("take profit should be partially filled: %#v", rec.trades)
+	}
+	ex.SetParticipation(0)
+	sendCandle(param, 1600000300, 100, 100, 89, 90)
+	if len(rec.trades) != 6 || rec.trades[5].Amount != 1 || ex.position != 0 || ex.orders.Len() != 0 {
+		t.Fatalf("stop loss should be reduced by take profit: %#v", rec.trades)
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong | Market, Amount: 1})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	param.SendWithExtra(EventOrder, EventOrder, &TradeAction{ID: "2", Action: StopLong, Amount: 1}, &OrderOption{TrailDistance: 5})
+	sendCandle(param, 1600000120, 100, 110, 106, 108)
+	o := ex.orders.Front().Value.(*order)
+	if len(rec.trades) != 1 || o.Price != 105 {
+		t.Fatalf("stop price should follow the highest price: %f", o.Price)
+	}
+	sendCandle(param, 1600000180, 108, 109, 104, 105)
+	if len(rec.trades) != 2 || rec.trades[1].Price != 105 || ex.position != 0 {
+		t.Fatalf("trailing stop should be triggered: %#v", rec.trades)
+	}
+	opt := OrderOption{TrailPercent: 10}
+	best, stop := opt.TrailStop(false, 0, 0, 100)
+	best, stop = opt.TrailStop(false, best, stop, 120)
+	if best != 100 || stop != 110 {
+		t.Fatalf("stop of short position should not move back: %f %f", best, stop)
+	}
+}
+
+func TestAmendOrder(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	var amends []OrderAmend
+	param.Subscribe(EventOrderAmend, func(e *Event) error {
+		amends = append(amends, *e.GetData().(*OrderAmend))
+		return nil
+	})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 90, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 91, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: CancelOne})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: AmendOne, Price: 99, Amount: 2})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: AmendOne, Price: 99})
+	if ex.orders.Len() != 1 || len(amends) != 2 || amends[0].Reason != "" || amends[1].Reason == "" {
+		t.Fatalf("amend result error: %#v", amends)
+	}
+	sendCandle(param, 1600000060, 100, 101, 98, 100)
+	if len(rec.trades) != 1 || rec.trades[0].Price != 99 || rec.trades[0].Amount != 2 {
+		t.Fatalf("order should be filled with amended price and amount: %#v", rec.trades)
+	}
+}
+
+func TestOrderStatus(t *testing.T) {
+	param, _, _ := newTestVExchange(t)
+	status := make(map[string][]OrderState)
+	param.Subscribe(EventOrderStatus, func(e *Event) error {
+		update := e.GetData().(*OrderUpdate)
+		status[update.Action.ID] = append(status[update.Action.ID], update.Status)
+		return nil
+	})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 98, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 90, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: StopLong, Price: 101, Amount: 1})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: CancelOne})
+	sendCandle(param, 1600000060, 100, 101, 97, 100)
+	expect := map[string][]OrderState{
+		"1": {OrderNew, OrderFilled},
+		"2": {OrderNew, OrderCanceled},
+		"3": {OrderRejected},
+	}
+	if !reflect.DeepEqual(status, expect) {
+		t.Fatalf("order status error: %#v", status)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	param.Bus.SetClock(NewVirtualClock())
+	ex.SetLatency(FixedLatency{Value: 30 * time.Second})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 99, Amount: 1})
+	sendCandle(param, 1600000060, 100, 101, 98, 100)
+	if len(rec.trades) != 0 {
+		t.Fatalf("order should not fill before it arrives: %#v", rec.trades)
+	}
+	sendCandle(param, 1600000120, 100, 101, 98, 100)
+	if len(rec.trades) != 1 || rec.trades[0].ID != "1" {
+		t.Fatalf("order should fill after it arrives: %#v", rec.trades)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: OpenLong, Price: 97, Amount: 1})
+	sendCandle(param, 1600000180, 100, 101, 99, 100)
+	sendCandle(param, 1600000240, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: CancelOne})
+	sendCandle(param, 1600000300, 100, 101, 96, 100)
+	if len(rec.trades) != 2 || rec.trades[1].ID != "2" {
+		t.Fatalf("order should fill before cancel arrives: %#v", rec.trades)
+	}
+}
+
+func TestSpotAccount(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetSpot(true)
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000, Fee: 0.001})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenShort, Price: 100, Amount: 1})
+	if ex.orders.Len() != 0 {
+		t.Fatal("short order should be rejected in spot account")
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: Market | OpenLong, Amount: 5})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	if math.Abs(ex.position-4.995) > 1e-9 {
+		t.Fatalf("fee of buy should be deducted in base: %f", ex.position)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: Market | CloseLong, Amount: 5})
+	sendCandle(param, 1600000120, 110, 111, 109, 110)
+	if len(rec.trades) != 2 || rec.trades[1].Amount != 4.995 || ex.position != 0 {
+		t.Fatalf("sell should sell the base held: %#v", rec.trades)
+	}
+	if math.Abs(ex.totalBalance()-1048.90055) > 1e-6 {
+		t.Fatalf("fee of sell should be deducted in quote: %f", ex.totalBalance())
+	}
+}
+
+func TestMakerTakerFee(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	fees := &FeeSchedule{Maker: -0.0002, Taker: 0.001, Tiers: []FeeTier{{Volume: 50, Maker: -0.0002, Taker: 0.0005}}}
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 100000, Fees: fees})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: OpenLong, Price: 98, Amount: 1})
+	sendCandle(param, 1600000060, 100, 101, 97, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: Market | CloseLong, Amount: 1})
+	sendCandle(param, 1600000120, 100, 101, 99, 100)
+	if len(rec.trades) != 2 || rec.trades[0].Remark != RemarkMaker || rec.trades[1].Remark != RemarkTaker {
+		t.Fatalf("resting order should be maker and market order taker: %#v", rec.trades)
+	}
+	// maker rebate 0.0196 and taker fee of tier 0.05, fee of close is charged by balance again
+	if math.Abs(ex.totalBalance()-100001.9392) > 1e-6 {
+		t.Fatalf("fee error: %f", ex.totalBalance())
+	}
+}
+
+func TestHedgeMode(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetHedge(true)
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: Market | OpenLong, Amount: 2})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: Market | OpenShort, Amount: 1})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	pos := ex.balance.(*HedgeBalance).Position()
+	if pos.Long.Hold != 2 || pos.Short.Hold != 1 || ex.position != 1 {
+		t.Fatalf("long and short should be held independently: %#v %f", pos, ex.position)
+	}
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "3", Action: Market | CloseLong, Amount: 5})
+	sendCandle(param, 1600000120, 110, 111, 109, 110)
+	pos = ex.balance.(*HedgeBalance).Position()
+	if len(rec.trades) != 3 || rec.trades[2].Amount != 2 || pos.Long.Hold != 0 || pos.Short.Hold != 1 {
+		t.Fatalf("close long should only close the long leg: %#v %#v", rec.trades, pos)
+	}
+	if pos.Long.Profit != 20 || ex.totalBalance() != 1020 {
+		t.Fatalf("profit of long leg error: %#v %f", pos, ex.totalBalance())
+	}
+}
+
+func TestHedgeDisabledKeepSpot(t *testing.T) {
+	_, ex, _ := newTestVExchange(t)
+	ex.SetSpot(true)
+	ex.SetHedge(false)
+	if _, ok := ex.balance.(*SpotBalance); !ok {
+		t.Fatalf("spot balance should be kept: %#v", ex.balance)
+	}
+	ex.SetHedge(true)
+	ex.SetHedge(false)
+	if _, ok := ex.balance.(*SpotBalance); !ok {
+		t.Fatalf("spot balance should be restored: %#v", ex.balance)
+	}
+}
+
+func TestHedgeCloseAll(t *testing.T) {
+	param, ex, rec := newTestVExchange(t)
+	ex.SetHedge(true)
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{Action: Market | OpenLong, Amount: 2})
+	param.Send(EventOrder, EventOrder, &TradeAction{Action: Market | OpenShort, Amount: 1})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	err := ex.CloseAll()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(rec.trades) != 4 {
+		t.Fatalf("both legs should be closed: %#v", rec.trades)
+	}
+	ids := make(map[string]bool)
+	for _, v := range rec.trades {
+		if ids[v.ID] {
+			t.Fatalf("trade id should be unique: %#v", rec.trades)
+		}
+		ids[v.ID] = true
+	}
+	pos := ex.balance.(*HedgeBalance).Position()
+	if pos.Long.Hold != 0 || pos.Short.Hold != 0 || rec.trades[2].Amount != 2 || rec.trades[3].Amount != 1 {
+		t.Fatalf("close trades error: %#v %#v", rec.trades, pos)
+	}
+}
+
+func TestHedgeCloseClamped(t *testing.T) {
+	param, ex, _ := newTestVExchange(t)
+	ex.SetHedge(true)
+	var updates []OrderUpdate
+	param.Subscribe(EventOrderStatus, func(e *Event) error {
+		updates = append(updates, *e.GetData().(*OrderUpdate))
+		return nil
+	})
+	param.Send("balance_init", EventBalanceInit, &BalanceInfo{Balance: 1000})
+	sendCandle(param, 1600000000, 100, 101, 99, 100)
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "1", Action: Market | OpenLong, Amount: 2})
+	param.Send(EventOrder, EventOrder, &TradeAction{ID: "2", Action: Market | CloseLong, Amount: 5})
+	sendCandle(param, 1600000060, 100, 101, 99, 100)
+	last := updates[len(updates)-1]
+	if last.Action.ID != "2" || last.Status != OrderCanceled || last.Filled != 2 {
+		t.Fatalf("close order should record the amount closed and cancel the rest: %#v", updates)
+	}
+	if ex.orders.Len() != 0 {
+		t.Fatalf("close order should be removed: %d", ex.orders.Len())
+	}
+}
@@ -3,12 +3,14 @@ package report
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"math"
 	"os"
 	"sort"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/montanaflynn/stats"
@@ -16,6 +18,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/ztrade/base/common"
 	. "github.com/ztrade/trademodel"
+	"github.com/ztrade/ztrade/pkg/core"
 	"xorm.io/xorm"
 )
 
@@ -39,15 +42,33 @@ type Report struct {
 	maxDrawdownValue float64
 	fee              float64
 	profitLoseRatio  float64
+	liquidations     int
+	fundings         []core.Funding
+	fundingTotal     float64
+	fees             *core.FeeSchedule
+	feeTotal         float64
+	makerVolume      float64
+	takerVolume      float64
+	longProfit       float64
+	shortProfit      float64
 
 	profitVariance float64
 	loseVariance   float64
 
 	lever float64
+	// spot trades are replayed with spot balance
+	spot bool
+	// hedge trades are replayed with long and short legs
+	hedge bool
+
+	// symbols reports of symbols in portfolio
+	symbols     map[string]*Report
+	symbolNames []string
 }
 
 type RptAct struct {
 	Trade       `xorm:"extends"`
+	Symbol      string
 	Total       float64
 	TotalProfit float64 // total profit,sum of all history profits,if action is open, total profit is zero
 	Profit      float64 // profit, if action is open, profit is zero
@@ -75,9 +96,72 @@ func (r *Report) SetLever(lever float64) {
 	r.lever = lever
 }
 
+// SetFees replay trades with maker and taker fee rates, the fee set by OnBalanceInit is used if nil
+func (r *Report) SetFees(fees *core.FeeSchedule) {
+	r.fees = fees
+}
+
+// SetSpot analyze trades of spot account, one round finishes when the base held is sold out
+func (r *Report) SetSpot(spot bool) {
+	r.spot = spot
+}
+
+// balancer balance to replay trades
+type balancer interface {
+	Set(total float64)
+	SetFee(fee float64)
+	SetLever(lever float64)
+	Get() float64
+	Pos() float64
+	AddTrade(tr Trade) (profit, onceFee float64, err error)
+}
+
+// SetHedge analyze trades of hedge mode account, profits are attributed to long and short legs,
+// one round finishes when the leg of trade is closed
+func (r *Report) SetHedge(hedge bool) {
+	r.hedge = hedge
+}
+
+func (r *Report) newBalance() balancer {
+	if r.spot {
+		return core.NewSpotBalance()
+	}
+	if r.hedge {
+		return core.NewHedgeBalance()
+	}
+	return common.NewLeverBalance()
+}
+
 func (r *Report) Analyzer() (err error) {
+	if len(r.symbols) > 1 {
+		return r.analyzePortfolio()
+	}
+	var fundingTotal float64
+	var fi int
+	// addFundings report funding payments not after end, all payments left are reported if end is zero
+	addFundings := func(end time.Time, balance float64, last *RptAct) {
+		for ; fi < len(r.fundings) && (end.IsZero() || !r.fundings[fi].Time.After(end)); fi++ {
+			f := r.fundings[fi]
+			fundingTotal = common.FloatAdd(fundingTotal, f.Amount)
+			fundingData := &RptAct{Trade: Trade{Time: f.Time, Price: f.Price, Amount: f.Hold, Remark: core.RemarkFunding},
+				Total:  common.FloatAdd(balance, fundingTotal),
+				Profit: f.Amount,
+			}
+			if last != nil {
+				fundingData.TotalProfit = last.TotalProfit
+			}
+			r.tmplDatas = append(r.tmplDatas, fundingData)
+		}
+	}
 	nLen := len(r.trades)
 	if nLen == 0 {
+		// funding is paid even without trades, e.g. position opened before the report
+		if len(r.fundings) > 0 {
+			addFundings(time.Time{}, r.balanceInit, nil)
+			r.fundingTotal = fundingTotal
+			r.profit = fundingTotal
+			r.balanceEnd = common.FloatAdd(r.balanceInit, fundingTotal)
+		}
 		return
 	}
 	i := nLen
@@ -97,19 +181,35 @@ func (r *Report) Analyzer() (err error) {
 	var lastMaxTotal, lastMinTotal, drawdown, drawdownValue float64
 	var profit, fee float64
 	var profitArray, loseArray []float64
-	bal := common.NewLeverBalance()
+	var volume float64
+	// profit and cost of long and short legs in current round, only used in hedge mode
+	var legProfit, legCost [2]float64
+	bal := r.newBalance()
 	bal.Set(r.balanceInit)
 	bal.SetFee(r.fee)
 	bal.SetLever(r.lever)
 	// startBalance := bal.Get()
 
 	for _, v := range r.trades {
+		// funding payments before the trade
+		addFundings(v.Time, bal.Get(), lastTmplData)
+		maker := v.Remark == core.RemarkMaker
+		if r.fees != nil {
+			bal.SetFee(r.fees.Rate(maker, volume))
+		}
 		profit, fee, err = bal.AddTrade(v)
 		if err != nil {
 			log.Error("Report add trade error:", err.Error())
 			return
 		}
 		actTotal = common.FloatMul(v.Price, v.Amount)
+		volume = common.FloatAdd(volume, actTotal)
+		if maker {
+			r.makerVolume = common.FloatAdd(r.makerVolume, actTotal)
+		} else {
+			r.takerVolume = common.FloatAdd(r.takerVolume, actTotal)
+		}
+		r.feeTotal = common.FloatAdd(r.feeTotal, fee)
 		if v.Action.IsLong() {
 			longAmount = common.FloatAdd(longAmount, v.Amount)
 			// log.Println("buy action", v.Time, v.Action, v.Price, v.Amount)
@@ -120,17 +220,43 @@ func (r *Report) Analyzer() (err error) {
 		if v.Action.IsOpen() {
 			costOnce = common.FloatAdd(costOnce, actTotal)
 		}
+		finish := longAmount == shortAmount
+		if r.spot {
+			// base held in spot is less than bought because of fee
+			finish = bal.Pos() == 0
+		} else if r.hedge {
+			leg, pos := 1, bal.(*core.HedgeBalance).Position()
+			hold := pos.Short.Hold
+			if core.IsLongLeg(v.Action) {
+				leg, hold = 0, pos.Long.Hold
+				r.longProfit = common.FloatAdd(r.longProfit, profit)
+			} else {
+				r.shortProfit = common.FloatAdd(r.shortProfit, profit)
+			}
+			legProfit[leg] = common.FloatAdd(legProfit[leg], profit)
+			if v.Action.IsOpen() {
+				legCost[leg] = common.FloatAdd(legCost[leg], actTotal)
+			}
+			finish = !v.Action.IsOpen() && hold == 0
+			if finish {
+				profit, costOnce = legProfit[leg], legCost[leg]
+				legProfit[leg], legCost[leg] = 0, 0
+			}
+		}
 
 		r.totalAction++
+		if v.Remark == core.RemarkLiquidation {
+			r.liquidations++
+		}
 		tmplData = &RptAct{Trade: v,
-			Total:    bal.Get(),
+			Total:    common.FloatAdd(bal.Get(), fundingTotal),
 			Profit:   profit,
 			Fee:      fee,
 			IsFinish: false,
 		}
 		r.tmplDatas = append(r.tmplDatas, tmplData)
 		// one round finish
-		if longAmount == shortAmount {
+		if finish {
 			tmplData.IsFinish = true
 			if lastTmplData != nil {
 				tmplData.TotalProfit = lastTmplData.TotalProfit
@@ -158,7 +284,7 @@ func (r *Report) Analyzer() (err error) {
 				}
 			}
 			costOnce = 0
-			r.balanceEnd = bal.Get()
+			r.balanceEnd = common.FloatAdd(bal.Get(), fundingTotal)
 		}
 		if tmplData.TotalProfit != 0 {
 			lastTmplData = tmplData
@@ -180,9 +306,16 @@ func (r *Report) Analyzer() (err error) {
 			}
 		}
 	}
+	// funding payments after the last trade
+	finished := fundingTotal
+	addFundings(time.Time{}, bal.Get(), lastTmplData)
+	if r.balanceEnd != 0 {
+		r.balanceEnd = common.FloatAdd(r.balanceEnd, common.FloatSub(fundingTotal, finished))
+	}
 	//	endBalance := bal.Get()
+	r.fundingTotal = fundingTotal
 	if lastTmplData != nil {
-		r.profit = lastTmplData.TotalProfit
+		r.profit = common.FloatAdd(lastTmplData.TotalProfit, fundingTotal)
 	}
 	// endBalance - startBalance
 	if total > 0 {
@@ -247,6 +380,41 @@ func (r *Report) MaxDrawdownValue() float64 {
 	return common.FormatFloat(r.maxDrawdownValue, 4)
 }
 
+// Liquidations count of liquidations
+func (r *Report) Liquidations() int {
+	return r.liquidations
+}
+
+// FundingTotal sum of funding payments, negative means paid
+func (r *Report) FundingTotal() float64 {
+	return common.FormatFloat(r.fundingTotal, 4)
+}
+
+// FeeTotal sum of fees paid, negative means rebate received
+func (r *Report) FeeTotal() float64 {
+	return common.FormatFloat(r.feeTotal, 4)
+}
+
+// MakerVolume traded volume in quote of maker trades
+func (r *Report) MakerVolume() float64 {
+	return common.FormatFloat(r.makerVolume, 4)
+}
+
+// TakerVolume traded volume in quote of taker trades
+func (r *Report) TakerVolume() float64 {
+	return common.FormatFloat(r.takerVolume, 4)
+}
+
+// LongProfit realized profit of long leg with fees in hedge mode
+func (r *Report) LongProfit() float64 {
+	return common.FormatFloat(r.longProfit, 4)
+}
+
+// ShortProfit realized profit of short leg with fees in hedge mode
+func (r *Report) ShortProfit() float64 {
+	return common.FormatFloat(r.shortProfit, 4)
+}
+
 func (r *Report) GetReport() (report string) {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("Total action:%d\n", len(r.actions)))
@@ -256,11 +424,23 @@ func (r *Report) GetReport() (report string) {
 	buf.WriteString(fmt.Sprintf("Max drawdown percent:%f%%\n", r.MaxDrawdown()))
 	buf.WriteString(fmt.Sprintf("Max drawdown value :%f\n", r.MaxDrawdown()))
 	buf.WriteString(fmt.Sprintf("Profit lose ratio: %f\n", r.ProfitLoseRatio()))
+	buf.WriteString(fmt.Sprintf("Liquidations: %d\n", r.Liquidations()))
+	buf.WriteString(fmt.Sprintf("Funding total: %f\n", r.FundingTotal()))
+	buf.WriteString(fmt.Sprintf("Fee total: %f\n", r.FeeTotal()))
+	buf.WriteString(fmt.Sprintf("Maker volume: %f\n", r.MakerVolume()))
+	buf.WriteString(fmt.Sprintf("Taker volume: %f\n", r.TakerVolume()))
+	if r.hedge {
+		buf.WriteString(fmt.Sprintf("Long profit: %f\n", r.LongProfit()))
+		buf.WriteString(fmt.Sprintf("Short profit: %f\n", r.ShortProfit()))
+	}
 	buf.WriteString(fmt.Sprintf("StartBalance: %f\n", r.balanceInit))
 	buf.WriteString(fmt.Sprintf("EndBalance: %f\n", r.EndBalance()))
 	buf.WriteString(fmt.Sprintf("ProfitPercent:%f\n", r.ProfitPercent()))
 	buf.WriteString(fmt.Sprintf("ProfitVariance:%f\n", r.ProfitVariance()))
 	buf.WriteString(fmt.Sprintf("LoseVariance:%f\n", r.LoseVariance()))
+	for _, v := range r.SymbolResults() {
+		buf.WriteString(fmt.Sprintf("%s: actions:%d win rate:%f profit:%f max drawdown:%f%%\n", v.Symbol, v.TotalAction, v.WinRate, v.Profit, v.MaxDrawdown))
+	}
 	data, _ := json.Marshal(r.profitHistory)
 	buf.WriteString(string(data))
 	report = buf.String()
@@ -298,6 +478,15 @@ func (r *Report) GenHTML(w io.Writer) (err error) {
 	data["profitPercent"] = r.ProfitPercent()
 	data["profitVariance"] = r.ProfitVariance()
 	data["loseVariance"] = r.LoseVariance()
+	data["liquidations"] = r.Liquidations()
+	data["fundingTotal"] = r.FundingTotal()
+	data["feeTotal"] = r.FeeTotal()
+	data["makerVolume"] = r.MakerVolume()
+	data["takerVolume"] = r.TakerVolume()
+	data["hedge"] = r.hedge
+	data["longProfit"] = r.LongProfit()
+	data["shortProfit"] = r.ShortProfit()
+	data["symbols"] = r.SymbolResults()
 	err = tmpl.Execute(w, data)
 	return
 }
@@ -312,6 +501,162 @@ func (r *Report) OnTrade(t Trade) {
 	r.trades = append(r.trades, t)
 }
 
+// OnSymbolTrade record trade of symbol, report is broken down by symbol if there are many symbols
+func (r *Report) OnSymbolTrade(symbol string, t Trade) {
+	r.trades = append(r.trades, t)
+	sub := r.symbolReport(symbol)
+	sub.trades = append(sub.trades, t)
+}
+
+func (r *Report) OnFunding(f core.Funding) {
+	r.fundings = append(r.fundings, f)
+	if f.Symbol != "" {
+		sub := r.symbolReport(f.Symbol)
+		sub.fundings = append(sub.fundings, f)
+	}
+}
+
+func (r *Report) symbolReport(symbol string) *Report {
+	if r.symbols == nil {
+		r.symbols = make(map[string]*Report)
+	}
+	sub, ok := r.symbols[symbol]
+	if !ok {
+		sub = NewReportSimple()
+		r.symbols[symbol] = sub
+		r.symbolNames = append(r.symbolNames, symbol)
+	}
+	return sub
+}
+
+// analyzePortfolio analyze every symbol, then aggregate results of all symbols
+func (r *Report) analyzePortfolio() (err error) {
+	var maxLose float64
+	for _, symbol := range r.symbolNames {
+		sub := r.symbols[symbol]
+		sub.balanceInit = r.balanceInit
+		sub.fee = r.fee
+		sub.lever = r.lever
+		sub.spot = r.spot
+		sub.hedge = r.hedge
+		sub.fees = r.fees
+		sort.SliceStable(sub.trades, func(i int, j int) bool {
+			return sub.trades[i].Time.Before(sub.trades[j].Time)
+		})
+		err = sub.Analyzer()
+		// symbol without profit or lose rounds has no variance
+		if err != nil && !errors.Is(err, stats.ErrEmptyInput) {
+			return
+		}
+		err = nil
+		for _, v := range sub.tmplDatas {
+			v.Symbol = symbol
+		}
+		r.tmplDatas = append(r.tmplDatas, sub.tmplDatas...)
+		r.totalAction += sub.totalAction
+		r.liquidations += sub.liquidations
+		r.fundingTotal = common.FloatAdd(r.fundingTotal, sub.fundingTotal)
+		r.feeTotal = common.FloatAdd(r.feeTotal, sub.feeTotal)
+		r.makerVolume = common.FloatAdd(r.makerVolume, sub.makerVolume)
+		r.takerVolume = common.FloatAdd(r.takerVolume, sub.takerVolume)
+		r.longProfit = common.FloatAdd(r.longProfit, sub.longProfit)
+		r.shortProfit = common.FloatAdd(r.shortProfit, sub.shortProfit)
+		r.profit = common.FloatAdd(r.profit, sub.profit)
+		if math.Abs(sub.maxLose) > math.Abs(maxLose) {
+			maxLose = sub.maxLose
+		}
+	}
+	r.maxLose = maxLose
+	sort.SliceStable(r.tmplDatas, func(i int, j int) bool {
+		return r.tmplDatas[i].Time.Before(r.tmplDatas[j].Time)
+	})
+	// rows of symbols are replaced with the total of all symbols
+	totals := make(map[string]float64)
+	totalProfits := make(map[string]float64)
+	var lastMaxTotal, lastMinTotal, drawdownValue, drawdown float64
+	var profitArray, loseArray []float64
+	var profitTotal, loseTotal float64
+	var success int
+	for _, v := range r.tmplDatas {
+		totals[v.Symbol] = common.FloatSub(v.Total, r.balanceInit)
+		totalProfits[v.Symbol] = v.TotalProfit
+		v.Total = r.balanceInit
+		v.TotalProfit = 0
+		for _, symbol := range r.symbolNames {
+			v.Total = common.FloatAdd(v.Total, totals[symbol])
+			v.TotalProfit = common.FloatAdd(v.TotalProfit, totalProfits[symbol])
+		}
+		if v.IsFinish {
+			r.profitHistory = append(r.profitHistory, v.Profit)
+			if v.Profit > 0 {
+				success++
+				profitArray = append(profitArray, v.Profit)
+				profitTotal = common.FloatAdd(profitTotal, v.Profit)
+			} else {
+				loseArray = append(loseArray, v.Profit)
+				loseTotal = common.FloatAdd(loseTotal, v.Profit)
+			}
+			r.balanceEnd = v.Total
+		}
+		if v.TotalProfit == 0 {
+			continue
+		}
+		if v.TotalProfit > lastMaxTotal {
+			lastMaxTotal = v.TotalProfit
+			lastMinTotal = lastMaxTotal
+		}
+		if v.TotalProfit < lastMinTotal {
+			lastMinTotal = v.TotalProfit
+		}
+		drawdownValue = common.FloatSub(lastMaxTotal, lastMinTotal)
+		if drawdownValue > r.maxDrawdownValue {
+			r.maxDrawdownValue = drawdownValue
+		}
+		drawdown = common.FloatDiv(common.FloatMul(drawdownValue, 100), lastMaxTotal+r.balanceInit)
+		if drawdown > r.maxDrawdown {
+			r.maxDrawdown = drawdown
+		}
+	}
+	if len(r.profitHistory) > 0 {
+		r.winRate = common.FloatDiv(float64(success), float64(len(r.profitHistory)))
+	}
+	if loseTotal != 0 {
+		r.profitLoseRatio = common.FloatDiv(profitTotal, math.Abs(loseTotal))
+	} else {
+		r.profitLoseRatio = profitTotal
+	}
+	if len(profitArray) > 0 {
+		r.profitVariance, err = stats.Variance(profitArray)
+		if err != nil {
+			return err
+		}
+	}
+	if len(loseArray) > 0 {
+		r.loseVariance, err = stats.Variance(loseArray)
+	}
+	return
+}
+
+// SymbolResults results of symbols, empty if the report is not a portfolio
+func (r *Report) SymbolResults() (rets []SymbolResult) {
+	if len(r.symbols) <= 1 {
+		return
+	}
+	for _, symbol := range r.symbolNames {
+		sub := r.symbols[symbol]
+		rets = append(rets, SymbolResult{
+			Symbol:       symbol,
+			TotalAction:  sub.totalAction,
+			WinRate:      sub.WinRate(),
+			Profit:       sub.Profit(),
+			MaxDrawdown:  sub.MaxDrawdown(),
+			Liquidations: sub.Liquidations(),
+			FundingTotal: sub.FundingTotal(),
+		})
+	}
+	return
+}
+
 func (r *Report) GenRPT(fPath string) (err error) {
 	sort.Slice(r.trades, func(i int, j int) bool {
 		return r.trades[i].Time.Unix() < r.trades[j].Time.Unix()
@@ -345,6 +690,14 @@ func (r *Report) GetResult() (ret ReportResult, err error) {
 	ret.ProfitPercent = r.ProfitPercent()
 	ret.ProfitVariance = r.ProfitVariance()
 	ret.LoseVariance = r.LoseVariance()
+	ret.Liquidations = r.Liquidations()
+	ret.FundingTotal = r.FundingTotal()
+	ret.TotalFee = r.FeeTotal()
+	ret.MakerVolume = r.MakerVolume()
+	ret.TakerVolume = r.TakerVolume()
+	ret.LongProfit = r.LongProfit()
+	ret.ShortProfit = r.ShortProfit()
+	ret.Symbols = r.SymbolResults()
 	return
 }
 
@@ -383,4 +736,22 @@ type ReportResult struct {
 	ProfitPercent    float64
 	ProfitVariance   float64
 	LoseVariance     float64
+	Liquidations     int
+	FundingTotal     float64
+	MakerVolume      float64
+	TakerVolume      float64
+	LongProfit       float64
+	ShortProfit      float64
+	Symbols          []SymbolResult `json:",omitempty"`
+}
+
+// SymbolResult result of one symbol in portfolio
+type SymbolResult struct {
+	Symbol       string
+	TotalAction  int
+	WinRate      float64
+	Profit       float64
+	MaxDrawdown  float64
+	Liquidations int
+	FundingTotal float64
 }